@@ -0,0 +1,163 @@
+package fusebox
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"bazil.org/fuse"
+)
+
+// atomicElement is used to represent a value from sync/atomic, which is read
+// and written using its Load, Store and CompareAndSwap methods. Values are
+// parsed relative to the current value, so that expressions such as "+=1" can
+// be applied with CompareAndSwap. If cas is nil, values are stored with Store.
+// Data appended to the File is parsed as it is, so that appending an
+// expression applies it.
+type atomicElement[T any] struct {
+	load   func() T
+	store  func(T)
+	cas    func(old, new T) bool
+	parse  func(s string, cur T) (T, error)
+	format func(T) string
+}
+
+// NewAtomicInt32File returns a File which has an element that atomically
+// loads and stores the given atomic.Int32. The same expressions as NewIntFile
+// are accepted, and are applied atomically with CompareAndSwap, unless the
+// File has Validators in which case the value may change in between.
+func NewAtomicInt32File(i *atomic.Int32) *File {
+	return NewFile(&atomicElement[int32]{
+		load:   i.Load,
+		store:  i.Store,
+		cas:    i.CompareAndSwap,
+		parse:  relativeExpressions(parseSigned[int32](32)),
+		format: formatSigned[int32],
+	})
+}
+
+// NewAtomicInt64File returns a File which has an element that atomically
+// loads and stores the given atomic.Int64, accepting expressions as with
+// NewAtomicInt32File.
+func NewAtomicInt64File(i *atomic.Int64) *File {
+	return NewFile(&atomicElement[int64]{
+		load:   i.Load,
+		store:  i.Store,
+		cas:    i.CompareAndSwap,
+		parse:  relativeExpressions(parseSigned[int64](64)),
+		format: formatSigned[int64],
+	})
+}
+
+// NewAtomicUint64File returns a File which has an element that atomically
+// loads and stores the given atomic.Uint64, accepting expressions as with
+// NewAtomicInt32File.
+func NewAtomicUint64File(i *atomic.Uint64) *File {
+	return NewFile(&atomicElement[uint64]{
+		load:   i.Load,
+		store:  i.Store,
+		cas:    i.CompareAndSwap,
+		parse:  relativeExpressions(parseUnsigned[uint64](64)),
+		format: formatUnsigned[uint64],
+	})
+}
+
+// NewAtomicBoolFile returns a File which has an element that atomically
+// loads and stores the given atomic.Bool, using the same format as
+// NewBoolFile. Writing "toggle" inverts the value atomically.
+func NewAtomicBoolFile(b *atomic.Bool) *File {
+	return NewFile(&atomicElement[bool]{
+		load:   b.Load,
+		store:  b.Store,
+		cas:    b.CompareAndSwap,
+		parse:  relativeToggle(parseBool),
+		format: formatBool,
+	})
+}
+
+// NewAtomicValueFile returns a File which has an element that atomically
+// loads and stores the given atomic.Value. Loaded values are displayed using
+// format, which is passed nil if no value has been stored yet. Written data
+// is trimmed of whitespace and passed to parse, and the value it returns is
+// stored. Errors from parse, or a value which is nil or of a different type
+// to the one already stored, result in fuse.ERANGE. If parse is nil, the
+// File is read-only.
+func NewAtomicValueFile(v *atomic.Value, format func(interface{}) string, parse func(string) (interface{}, error)) *File {
+	e := &atomicElement[interface{}]{load: v.Load, store: v.Store, format: format}
+	if parse == nil {
+		e.parse = func(string, interface{}) (interface{}, error) {
+			return nil, fuse.EPERM
+		}
+		ret := NewFile(e)
+		ret.Mode = 0444
+		return ret
+	}
+
+	e.parse = func(s string, cur interface{}) (interface{}, error) {
+		n, err := parse(s)
+		if err != nil || n == nil {
+			return nil, fuse.ERANGE
+		}
+
+		if cur != nil && reflect.TypeOf(cur) != reflect.TypeOf(n) {
+			return nil, fuse.ERANGE
+		}
+		return n, nil
+	}
+	return NewFile(e)
+}
+
+func (e *atomicElement[T]) ValRead(ctx context.Context) ([]byte, error) {
+	return []byte(e.format(e.load())), nil
+}
+
+// ValWrite parses the data relative to the current value and stores the
+// result, retrying if the value is changed in between.
+func (e *atomicElement[T]) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	for {
+		cur := e.load()
+		v, err := e.parseAt(req.Data, cur)
+		if err != nil {
+			return err
+		}
+
+		if e.cas == nil {
+			e.store(v)
+			break
+		}
+		if e.cas(cur, v) {
+			break
+		}
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (e *atomicElement[T]) appendData(data []byte) []byte {
+	return data
+}
+
+func (e *atomicElement[T]) Parse(data []byte) (interface{}, error) {
+	return e.parseAt(data, e.load())
+}
+
+// parseAt parses the data relative to the value cur.
+func (e *atomicElement[T]) parseAt(data []byte, cur T) (T, error) {
+	v, err := e.parse(strings.TrimSpace(string(data)), cur)
+	if err != nil {
+		if _, ok := err.(fuse.ErrorNumber); !ok {
+			err = fuse.ERANGE
+		}
+	}
+	return v, err
+}
+
+func (e *atomicElement[T]) Assign(v interface{}) {
+	e.store(v.(T))
+}
+
+func (e *atomicElement[T]) Size(context.Context) (uint64, error) {
+	return uint64(len(e.format(e.load()))), nil
+}
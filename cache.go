@@ -0,0 +1,94 @@
+package fusebox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// CachedElement is a FileElement which wraps another, and caches the value
+// returned by its ValRead function for a period of time. Both ValRead and Size
+// are served from the cached value, which suits elements that are expensive
+// to compute, such as those created with NewFuncFile:
+//
+//	f := NewReadOnlyFuncFile(scan)
+//	f.Element = NewCachedElement(f.Element, 5*time.Second)
+//
+// The cache is invalidated by a successful ValWrite, by the File's Touch
+// function, or by calling Invalidate. As CachedElement doesn't implement
+// ValueElement, the File's Validators are passed the written []byte.
+type CachedElement struct {
+	// The wrapped element.
+	Element FileElement
+
+	// How long a value is cached for. If TTL is zero, the value is cached
+	// until the cache is invalidated.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	data    []byte
+	expires time.Time
+	valid   bool
+}
+
+var _ FileElement = (*CachedElement)(nil)
+
+// NewCachedElement returns a CachedElement which caches the value of the given
+// FileElement for the given TTL.
+func NewCachedElement(e FileElement, ttl time.Duration) *CachedElement {
+	return &CachedElement{Element: e, TTL: ttl}
+}
+
+// value returns the cached value, reading a new value from the wrapped
+// element if there isn't one or it has expired.
+func (c *CachedElement) value(ctx context.Context) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.valid && (c.TTL == 0 || time.Now().Before(c.expires)) {
+		return c.data, nil
+	}
+
+	data, err := c.Element.ValRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.data, c.valid = data, true
+	c.expires = time.Now().Add(c.TTL)
+	return data, nil
+}
+
+// ValRead returns the cached value.
+func (c *CachedElement) ValRead(ctx context.Context) ([]byte, error) {
+	return c.value(ctx)
+}
+
+// ValWrite passes the write to the wrapped element, and invalidates the cache
+// if it succeeds.
+func (c *CachedElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if err := c.Element.ValWrite(ctx, req, resp); err != nil {
+		return err
+	}
+
+	c.Invalidate()
+	return nil
+}
+
+// Size returns the length of the cached value.
+func (c *CachedElement) Size(ctx context.Context) (uint64, error) {
+	data, err := c.value(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(data)), nil
+}
+
+// Invalidate discards the cached value, so that the next read or call to Size
+// reads a new value from the wrapped element.
+func (c *CachedElement) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data, c.valid = nil, false
+}
@@ -0,0 +1,74 @@
+package fusebox
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCachedElement(t *testing.T) {
+	var calls int
+	read := func(ctx context.Context) ([]byte, error) {
+		calls++
+		return []byte(fmt.Sprintf("value %v", calls)), nil
+	}
+	write := func(ctx context.Context, data []byte) error {
+		return nil
+	}
+
+	f := NewFuncFile(read, write)
+	c := NewCachedElement(f.Element, 0)
+	f.Element = c
+
+	name := "cached"
+	if err := rootdir.AddNode(name, f); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	expectRead := func(t *testing.T, expected string) {
+		for i := 0; i < 2; i++ {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read node: %v", err)
+			}
+
+			if string(data) != expected {
+				t.Errorf("incorrect value read, expected '%v', got '%s'", expected, data)
+			}
+		}
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		expectRead(t, "value 1")
+	})
+
+	t.Run("write", func(t *testing.T) {
+		if err := ioutil.WriteFile(path, []byte("x"), 0666); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+		expectRead(t, "value 2")
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		c.Invalidate()
+		expectRead(t, "value 3")
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		f.Touch()
+		expectRead(t, "value 4")
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		c.TTL = 50 * time.Millisecond
+		c.Invalidate()
+		expectRead(t, "value 5")
+		time.Sleep(100 * time.Millisecond)
+		expectRead(t, "value 6")
+	})
+}
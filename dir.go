@@ -49,6 +49,17 @@ type DirElement interface {
 	RemoveNode(name string) error
 }
 
+// The CreatableDirElement interface can be implemented by a DirElement to
+// allow files to be created in the dir through the filesystem.
+type CreatableDirElement interface {
+	DirElement
+
+	// CreateNode should add a new node with the given name, and return it.
+	// If this fails, an error should be returned, which is passed in the
+	// return value to Dir.Create.
+	CreateNode(ctx context.Context, name string) (VarNode, error)
+}
+
 // Dir represents a directory in the filesystem. It contains subnodes of type
 // fs.Node, usually Dir or VarNode.
 type Dir struct {
@@ -61,6 +72,13 @@ type Dir struct {
 	// The Element is used to interact with the underlying data
 	mu      *sync.RWMutex
 	Element DirElement
+
+	// The subscriptions to changes to files in the dir, and the path prefix
+	// reported to each.
+	subs map[*Subscription]string
+
+	// The filesystems the dir has been served from.
+	mounts
 }
 
 // NewDir creates a new directoy based on the given DirElement. This DirElement is
@@ -73,20 +91,57 @@ func NewDir(e DirElement) *Dir {
 	}
 }
 
-// AddNode adds a node to the directory.
+// AddNode adds a node to the directory, and invalidates any entry the kernel
+// has cached for the given name.
 func (d *Dir) AddNode(name string, node fs.Node) error {
 	d.mu.Lock()
-	defer d.mu.Unlock()
-	return d.Element.AddNode(name, node)
+	old, _ := d.Element.GetNode(context.Background(), name)
+	if err := d.Element.AddNode(name, node); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+
+	d.moveSubscriptions(name, old, node)
+	d.mu.Unlock()
+	d.invalidateEntry(name)
+	return nil
 }
 
 // RemoveNode removes a node from the dir, and returns whether the node originally
-// existed.
+// existed. Any entry the kernel has cached for the node is invalidated.
 func (d *Dir) RemoveNode(k string) bool {
 	d.mu.Lock()
-	defer d.mu.Unlock()
-	err := d.Element.RemoveNode(k)
-	return err == nil
+	err := d.removeNode(k)
+	d.mu.Unlock()
+	if err != nil {
+		return false
+	}
+
+	d.invalidateEntry(k)
+	return true
+}
+
+// invalidateEntry invalidates the kernel's cache of the entry with the given
+// name in every filesystem the dir has been served from. Errors are ignored,
+// as with File.Touch. This must not be
+// called while holding d.mu, as the kernel may be waiting on a lookup in the
+// dir to complete.
+func (d *Dir) invalidateEntry(name string) {
+	for _, m := range d.filesystems() {
+		_ = m.invalidateEntry(d, name)
+	}
+}
+
+// removeNode removes a node from the dir's element, and unsubscribes it from
+// the dir's subscriptions. The caller must hold d.mu.
+func (d *Dir) removeNode(k string) error {
+	old, _ := d.Element.GetNode(context.Background(), k)
+	if err := d.Element.RemoveNode(k); err != nil {
+		return err
+	}
+
+	d.moveSubscriptions(k, old, nil)
+	return nil
 }
 
 var _ fs.Node = (*Dir)(nil)
@@ -114,7 +169,13 @@ func (d *Dir) Lookup(ctx context.Context, req *fuse.LookupRequest, resp *fuse.Lo
 	resp.EntryValid = 0
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	return d.Element.GetNode(ctx, req.Name)
+	n, err := d.Element.GetNode(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	addMount(n, contextFS(ctx))
+	return n, nil
 }
 
 // ReadDirAll returns a []fuse.Dirent representing all nodes in the Dir.
@@ -154,8 +215,41 @@ func (d *Dir) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
 		return fuse.EPERM
 	}
 	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.removeNode(req.Name)
+}
+
+// Create handles a request from the filesystem to create a file, passing the
+// request through to the Dir's element if it implements CreatableDirElement,
+// and returning fuse.EPERM otherwise. The new node is then opened.
+func (d *Dir) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	e, ok := d.Element.(CreatableDirElement)
+	if !ok || d.Mode&0222 == 0 {
+		return nil, nil, fuse.EPERM
+	}
+
+	d.mu.Lock()
+	n, err := e.CreateNode(ctx, req.Name)
+	if err != nil {
+		d.mu.Unlock()
+		return nil, nil, err
+	}
+
+	d.moveSubscriptions(req.Name, nil, n)
 	d.mu.Unlock()
-	return d.Element.RemoveNode(req.Name)
+	addMount(n, contextFS(ctx))
+
+	o, ok := n.(fs.NodeOpener)
+	if !ok {
+		return n, n, nil
+	}
+
+	open := &fuse.OpenRequest{Header: req.Header, Flags: req.Flags}
+	h, err := o.Open(ctx, open, &resp.OpenResponse)
+	if err != nil {
+		return nil, nil, err
+	}
+	return n, h, nil
 }
 
 // Open returns the Dir as the handle, setting the response flags with Dir.OpenFlags
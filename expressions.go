@@ -0,0 +1,119 @@
+package fusebox
+
+import (
+	"math"
+	"strings"
+
+	"bazil.org/fuse"
+)
+
+// expressionOps are the operators accepted by withExpressions.
+var expressionOps = []string{"+=", "-=", "*=", "max=", "min="}
+
+// withExpressions wraps parse so that it also accepts expressions relative to
+// the value pointed to by ptr: "+=N", "-=N" and "*=N" add, subtract or
+// multiply the value by N, while "max=N" and "min=N" raise or lower it to N.
+// N is parsed using parse. As parse is called while the File's Lock is held,
+// the expression is applied atomically with respect to other writes. Results
+// which overflow T are rejected with fuse.ERANGE.
+func withExpressions[T number](ptr *T, parse func(string) (T, error)) func(string) (T, error) {
+	relative := relativeExpressions(parse)
+	return func(s string) (T, error) {
+		return relative(s, *ptr)
+	}
+}
+
+// relativeExpressions wraps parse so that it accepts the expressions accepted
+// by withExpressions, relative to the value it is passed.
+func relativeExpressions[T number](parse func(string) (T, error)) func(string, T) (T, error) {
+	return func(s string, cur T) (T, error) {
+		for _, op := range expressionOps {
+			if !strings.HasPrefix(s, op) {
+				continue
+			}
+
+			n, err := parse(strings.TrimSpace(s[len(op):]))
+			if err != nil {
+				return 0, err
+			}
+			return applyExpression(cur, op, n)
+		}
+		return parse(s)
+	}
+}
+
+// relativeValueElement is a valueElement whose parse function accepts values
+// relative to the current one, such as those of withExpressions and
+// toggleBool. Data appended to the File is parsed as it is, so that
+// `echo +=1 >> file` applies the expression.
+type relativeValueElement[T any] struct {
+	valueElement[T]
+}
+
+// relativeValueFile returns a File as with NewValueFile, for a parse function
+// which accepts values relative to the current one.
+func relativeValueFile[T any](ptr *T, parse func(string) (T, error), format func(T) string) *File {
+	return NewFile(&relativeValueElement[T]{valueElement[T]{Data: ptr, parse: parse, format: format}})
+}
+
+func (e *relativeValueElement[T]) appendData(data []byte) []byte {
+	return data
+}
+
+// applyExpression returns the result of applying the operator to cur and n.
+func applyExpression[T number](cur T, op string, n T) (T, error) {
+	var ret T
+	switch op {
+	case "+=":
+		ret = cur + n
+		if (n > 0 && ret < cur) || (n < 0 && ret > cur) {
+			return 0, fuse.ERANGE
+		}
+	case "-=":
+		ret = cur - n
+		if (n > 0 && ret > cur) || (n < 0 && ret < cur) {
+			return 0, fuse.ERANGE
+		}
+	case "*=":
+		ret = cur * n
+		half := 0.5
+		if T(half) == 0 && cur != 0 && (ret/cur != n || (cur < 0 && n != 0 && ret == n)) {
+			return 0, fuse.ERANGE
+		}
+	case "max=":
+		ret = cur
+		if n > cur {
+			ret = n
+		}
+	case "min=":
+		ret = cur
+		if n < cur {
+			ret = n
+		}
+	}
+
+	if f := float64(ret); math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fuse.ERANGE
+	}
+	return ret, nil
+}
+
+// toggleBool wraps parse so that it also accepts "toggle", which inverts the
+// value pointed to by ptr.
+func toggleBool(ptr *bool, parse func(string) (bool, error)) func(string) (bool, error) {
+	relative := relativeToggle(parse)
+	return func(s string) (bool, error) {
+		return relative(s, *ptr)
+	}
+}
+
+// relativeToggle wraps parse so that it also accepts "toggle", which inverts
+// the value it is passed.
+func relativeToggle(parse func(string) (bool, error)) func(string, bool) (bool, error) {
+	return func(s string, cur bool) (bool, error) {
+		if s == "toggle" {
+			return !cur, nil
+		}
+		return parse(s)
+	}
+}
@@ -1,7 +1,9 @@
 package fusebox
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
@@ -12,6 +14,7 @@ type FS struct {
 	RootNode VarNodeable
 	Name     string
 	conn     *fuse.Conn
+	server   *fs.Server
 }
 
 var _ fs.FS = (*FS)(nil)
@@ -31,7 +34,9 @@ func NewEmptyFS() (*FS, *Dir) {
 
 // Root returns the root directory of the filesystem
 func (f *FS) Root() (fs.Node, error) {
-	return f.RootNode.Node(), nil
+	n := f.RootNode.Node()
+	addMount(n, f)
+	return n, nil
 }
 
 // Mount mounts the filesystem at the given path.
@@ -44,8 +49,13 @@ func (f *FS) Mount(path string) error {
 	}
 
 	f.conn = c
+	f.server = fs.New(f.conn, &fs.Config{
+		WithContext: func(ctx context.Context, req fuse.Request) context.Context {
+			return context.WithValue(ctx, fsContextKey{}, f)
+		},
+	})
 	go func() {
-		fs.Serve(f.conn, f)
+		f.server.Serve(f)
 	}()
 
 	<-f.conn.Ready
@@ -55,3 +65,78 @@ func (f *FS) Mount(path string) error {
 
 	return nil
 }
+
+// Invalidate invalidates the kernel's cache of the data and attributes of the
+// given node, so that changes made to it outside of the filesystem are seen
+// by the next read. It does nothing if the filesystem isn't mounted, or if
+// the kernel isn't caching the node.
+func (f *FS) Invalidate(node fs.Node) error {
+	if f.server == nil {
+		return nil
+	}
+
+	err := f.server.InvalidateNodeData(node)
+	if err == fuse.ErrNotCached {
+		return nil
+	}
+	return err
+}
+
+// invalidateEntry invalidates the kernel's cache of the entry with the given
+// name in the given dir. It does nothing if the filesystem isn't mounted, or
+// if the kernel isn't caching the entry.
+func (f *FS) invalidateEntry(dir fs.Node, name string) error {
+	if f.server == nil {
+		return nil
+	}
+
+	err := f.server.InvalidateEntry(dir, name)
+	if err == fuse.ErrNotCached {
+		return nil
+	}
+	return err
+}
+
+// fsContextKey is the context key used to store the FS serving a request.
+type fsContextKey struct{}
+
+// mounts records the filesystems a node has been served from, so that the
+// kernel's caches for it can be invalidated.
+type mounts struct {
+	mu  sync.Mutex
+	fss map[*FS]struct{}
+}
+
+func (m *mounts) addMount(f *FS) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.fss == nil {
+		m.fss = make(map[*FS]struct{})
+	}
+	m.fss[f] = struct{}{}
+}
+
+// filesystems returns the filesystems the node has been served from.
+func (m *mounts) filesystems() []*FS {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]*FS, 0, len(m.fss))
+	for f := range m.fss {
+		ret = append(ret, f)
+	}
+	return ret
+}
+
+// addMount records that the given node has been served from f, if it is a
+// node that keeps track of this.
+func addMount(n fs.Node, f *FS) {
+	if m, ok := n.(interface{ addMount(*FS) }); ok && f != nil {
+		m.addMount(f)
+	}
+}
+
+// contextFS returns the FS serving the request the given context belongs to.
+func contextFS(ctx context.Context) *FS {
+	f, _ := ctx.Value(fsContextKey{}).(*FS)
+	return f
+}
@@ -0,0 +1,146 @@
+package fusebox
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"bazil.org/fuse"
+)
+
+// NewFlagsDir returns a Dir exposing the bits of the given mask as a file for
+// each entry in names, which maps the names of the files to the bits they
+// control. Each file displays 1 if all of its bits are set and 0 otherwise, and
+// writing 1 or 0 sets or clears them, using the same format as NewBoolFile.
+// Writing "toggle" inverts them atomically, setting them all unless they were
+// all set.
+//
+// The Dir also contains a file named "value", which displays the whole mask in
+// hexadecimal, such as "0x1f", and can be written to replace it. Values written
+// to it may be in decimal, or in hexadecimal, octal or binary with a prefix, as
+// with strconv.ParseUint. An entry in names called "value" is replaced by this
+// file.
+//
+// The mask is only loaded and stored using the functions in sync/atomic, so
+// other code can safely update it concurrently in the same way.
+func NewFlagsDir(ptr *uint64, names map[string]uint64) *Dir {
+	nodes := make(map[string]VarNodeable, len(names)+1)
+	for name, mask := range names {
+		nodes[name] = NewFile(&flagElement{Data: ptr, mask: mask})
+	}
+
+	value := NewFile(&flagsValueElement{Data: ptr})
+	value.OpenFlags = fuse.OpenDirectIO
+	nodes["value"] = value
+
+	return NewMapDir(nodes)
+}
+
+// flagElement is used to represent some bits of a mask as a bool.
+type flagElement struct {
+	Data *uint64
+	mask uint64
+}
+
+func (f *flagElement) ValRead(ctx context.Context) ([]byte, error) {
+	return []byte(formatBool(atomic.LoadUint64(f.Data)&f.mask == f.mask)), nil
+}
+
+// ValWrite sets or clears the bits, retrying if the mask is changed
+// concurrently so that "toggle" is applied atomically.
+func (f *flagElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	for {
+		old := atomic.LoadUint64(f.Data)
+		v, err := f.parseAt(req.Data, old)
+		if err != nil {
+			return err
+		}
+
+		if atomic.CompareAndSwapUint64(f.Data, old, f.apply(old, v)) {
+			break
+		}
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// appendData returns the data as it is, so that appending "toggle" inverts the
+// bits.
+func (f *flagElement) appendData(data []byte) []byte {
+	return data
+}
+
+func (f *flagElement) Parse(data []byte) (interface{}, error) {
+	return f.parseAt(data, atomic.LoadUint64(f.Data))
+}
+
+// parseAt parses the data as a bool, where "toggle" inverts whether the bits
+// are all set in the mask m.
+func (f *flagElement) parseAt(data []byte, m uint64) (bool, error) {
+	return relativeToggle(parseBool)(strings.TrimSpace(string(data)), m&f.mask == f.mask)
+}
+
+// apply returns the mask m with the bits set or cleared.
+func (f *flagElement) apply(m uint64, set bool) uint64 {
+	if set {
+		return m | f.mask
+	}
+	return m &^ f.mask
+}
+
+// Assign sets or clears the bits, retrying if the mask is changed
+// concurrently.
+func (f *flagElement) Assign(v interface{}) {
+	for {
+		old := atomic.LoadUint64(f.Data)
+		if atomic.CompareAndSwapUint64(f.Data, old, f.apply(old, v.(bool))) {
+			return
+		}
+	}
+}
+
+func (*flagElement) Size(context.Context) (uint64, error) {
+	return 1, nil
+}
+
+// flagsValueElement is used to represent a whole mask in hexadecimal.
+type flagsValueElement struct {
+	Data *uint64
+}
+
+func (f *flagsValueElement) ValRead(ctx context.Context) ([]byte, error) {
+	return []byte(f.format()), nil
+}
+
+func (f *flagsValueElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	v, err := f.Parse(req.Data)
+	if err != nil {
+		return err
+	}
+
+	f.Assign(v)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (f *flagsValueElement) Parse(data []byte) (interface{}, error) {
+	i, err := strconv.ParseUint(trimNumber(data), 0, 64)
+	if err != nil {
+		return nil, fuse.ERANGE
+	}
+	return i, nil
+}
+
+func (f *flagsValueElement) Assign(v interface{}) {
+	atomic.StoreUint64(f.Data, v.(uint64))
+}
+
+func (f *flagsValueElement) Size(context.Context) (uint64, error) {
+	return uint64(len(f.format())), nil
+}
+
+func (f *flagsValueElement) format() string {
+	return "0x" + strconv.FormatUint(atomic.LoadUint64(f.Data), 16)
+}
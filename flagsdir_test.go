@@ -0,0 +1,75 @@
+package fusebox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+func TestFlagsDir(t *testing.T) {
+	var mask uint64 = 0x4
+	d := NewFlagsDir(&mask, map[string]uint64{
+		"debug": 0x1,
+		"trace": 0x2,
+		"audit": 0x4,
+		"all":   0x7,
+	})
+
+	name := "flags"
+	if err := rootdir.AddNode(name, d); err != nil {
+		t.Fatalf("failed to add dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	dpath := path.Join(mountpoint, name)
+
+	t.Run("nodes", func(t *testing.T) {
+		checkDirContents(t, dpath, []string{"debug", "trace", "audit", "all", "value"})
+	})
+
+	tests := []struct {
+		name     string
+		writeVal []byte
+		writeErr error
+		mask     uint64
+		reads    map[string]string
+	}{
+		{"debug", []byte("1\n"), nil, 0x5, map[string]string{"debug": "1", "trace": "0", "all": "0", "value": "0x5"}},
+		{"trace", []byte("1"), nil, 0x7, map[string]string{"trace": "1", "all": "1", "value": "0x7"}},
+		{"audit", []byte("0"), nil, 0x3, map[string]string{"audit": "0", "all": "0", "value": "0x3"}},
+		{"audit", []byte("yes"), fuse.ERANGE, 0x3, map[string]string{"audit": "0"}},
+		{"all", []byte("1"), nil, 0x7, map[string]string{"debug": "1", "audit": "1", "value": "0x7"}},
+		{"value", []byte("0x102"), nil, 0x102, map[string]string{"debug": "0", "trace": "1", "value": "0x102"}},
+		{"value", []byte("12"), nil, 0xc, map[string]string{"audit": "1", "value": "0xc"}},
+		{"value", []byte("0xz"), fuse.ERANGE, 0xc, map[string]string{"value": "0xc"}},
+		{"debug", []byte("toggle\n"), nil, 0xd, map[string]string{"debug": "1", "value": "0xd"}},
+		{"all", []byte("toggle"), nil, 0xf, map[string]string{"trace": "1", "all": "1", "value": "0xf"}},
+		{"all", []byte("toggle"), nil, 0x8, map[string]string{"debug": "0", "all": "0", "value": "0x8"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ioutil.WriteFile(path.Join(dpath, tt.name), tt.writeVal, 0666)
+			if !checkError(err, tt.writeErr) {
+				t.Errorf("incorrect error writing '%s', expected: %v, got: %v", tt.writeVal, tt.writeErr, err)
+			}
+
+			if mask != tt.mask {
+				t.Errorf("incorrect mask, expected %#x, got %#x", tt.mask, mask)
+			}
+
+			for f, expected := range tt.reads {
+				data, err := ioutil.ReadFile(path.Join(dpath, f))
+				if err != nil {
+					t.Fatalf("failed to read %v: %v", f, err)
+				}
+
+				if !bytes.Equal(data, []byte(expected)) {
+					t.Errorf("incorrect value read from %v, expected '%v', got '%s'", f, expected, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package fusebox
+
+import (
+	"context"
+
+	"bazil.org/fuse"
+)
+
+// funcElement is used to represent a value which is computed by a function
+// rather than stored in a variable.
+type funcElement struct {
+	read  func(context.Context) ([]byte, error)
+	write func(context.Context, []byte) error
+}
+
+// NewFuncFile returns a File whose value is computed by calling read, and
+// which passes written data to write, such as for a queue length or a setting
+// derived from others. Written data is passed as is, without trimming
+// whitespace. If write returns an error, the write fails with fuse.ERANGE,
+// unless the error is a fuse.ErrorNumber in which case it is returned as is.
+// If write is nil, the File's Mode is set to 0444.
+//
+// Snapshot is set, so that read is called once when the file is opened, and
+// every read through that open file, at any offset, is served from the value
+// it returned. So that looking up or examining the file doesn't call read, its
+// size is reported as 0, as with Stream files, except through an open file
+// where it is the size of the captured value. The File is also Volatile, so
+// that the kernel doesn't cache either size.
+func NewFuncFile(read func(ctx context.Context) ([]byte, error), write func(ctx context.Context, data []byte) error) *File {
+	ret := NewFile(&funcElement{read: read, write: write})
+	ret.Volatile = true
+	ret.Snapshot = true
+	if write == nil {
+		ret.Mode = 0444
+	}
+	return ret
+}
+
+// NewReadOnlyFuncFile returns a read-only File whose value is computed by
+// calling read. This is equivalent to NewFuncFile(read, nil).
+func NewReadOnlyFuncFile(read func(ctx context.Context) ([]byte, error)) *File {
+	return NewFuncFile(read, nil)
+}
+
+func (e *funcElement) ValRead(ctx context.Context) ([]byte, error) {
+	return e.read(ctx)
+}
+
+func (e *funcElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if e.write == nil {
+		return fuse.EPERM
+	}
+
+	if err := e.write(ctx, req.Data); err != nil {
+		if _, ok := err.(fuse.ErrorNumber); ok {
+			return err
+		}
+		return fuse.ERANGE
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// Size returns 0, so that read is only called when the file is opened.
+func (e *funcElement) Size(ctx context.Context) (uint64, error) {
+	return 0, nil
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"syscall"
 	"testing"
 
 	"bazil.org/fuse"
@@ -24,6 +25,12 @@ func checkError(err error, fuseErr error) bool {
 		return err != nil && strings.Contains(err.Error(), "numerical result out of range")
 	case fuse.EPERM:
 		return err != nil && strings.Contains(err.Error(), "operation not permitted")
+	case fuse.Errno(syscall.EINVAL):
+		return err != nil && strings.Contains(err.Error(), "invalid argument")
+	case fuse.Errno(syscall.EACCES):
+		return err != nil && strings.Contains(err.Error(), "permission denied")
+	case fuse.Errno(syscall.EBUSY):
+		return err != nil && strings.Contains(err.Error(), "device or resource busy")
 	}
 
 	log.Printf("warning: unknown fuse error: %v", fuseErr)
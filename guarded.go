@@ -0,0 +1,51 @@
+package fusebox
+
+// Guarded holds a value which is exposed through a File, and shares the File's
+// Lock so that access to the value from go code is synchronised with reads and
+// writes through the filesystem.
+type Guarded[T any] struct {
+	v    T
+	file *File
+}
+
+// NewGuarded returns a Guarded holding the given value, and the File exposing
+// it, which is created by passing a pointer to the held value to newFile. Any
+// of the typed File constructors can be used, for example:
+//
+//	port, f := NewGuarded(8080, NewIntFile)
+func NewGuarded[T any](v T, newFile func(*T) *File) (*Guarded[T], *File) {
+	g := &Guarded[T]{v: v}
+	g.file = newFile(&g.v)
+	return g, g.file
+}
+
+// Get returns the held value.
+func (g *Guarded[T]) Get() T {
+	g.file.Lock.RLock()
+	defer g.file.Lock.RUnlock()
+	return g.v
+}
+
+// Set replaces the held value, and touches the File so that the change is
+// seen by the filesystem.
+func (g *Guarded[T]) Set(v T) {
+	g.file.Lock.Lock()
+	g.v = v
+	g.file.Lock.Unlock()
+	g.file.Touch()
+}
+
+// Update calls fn with a pointer to the held value while holding the lock, so
+// that the value can be read and modified atomically, and then touches the
+// File so that the change is seen by the filesystem.
+func (g *Guarded[T]) Update(fn func(v *T)) {
+	g.file.Lock.Lock()
+	fn(&g.v)
+	g.file.Lock.Unlock()
+	g.file.Touch()
+}
+
+// File returns the File exposing the held value.
+func (g *Guarded[T]) File() *File {
+	return g.file
+}
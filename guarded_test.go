@@ -0,0 +1,63 @@
+package fusebox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"sync"
+	"testing"
+)
+
+func TestGuarded(t *testing.T) {
+	g, f := NewGuarded(1, NewIntFile)
+	name := "guarded"
+	if err := rootdir.AddNode(name, f); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	t.Run("write", func(t *testing.T) {
+		if err := ioutil.WriteFile(path, []byte("42"), 0666); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		if g.Get() != 42 {
+			t.Errorf("incorrect value after writing, expected 42, got %v", g.Get())
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		g.Set(1000)
+		r, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("couldn't read file: %v", err)
+		}
+
+		if !bytes.Equal(r, []byte("1000")) {
+			t.Errorf("incorrect value read after set, expected '1000', got '%s'", r)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		g.Set(0)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.Update(func(v *int) { *v++ })
+			}()
+		}
+		wg.Wait()
+
+		r, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("couldn't read file: %v", err)
+		}
+
+		if !bytes.Equal(r, []byte("100")) {
+			t.Errorf("incorrect value read after updates, expected '100', got '%s'", r)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package fusebox
+
+import (
+	"context"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// A Handle is created each time a File is opened, and is used to serve the
+// requests made through that open file. It can carry state for the open file,
+// which allows elements to implement per-open behaviour, such as a reader's
+// position in a stream.
+//
+// Requests made through a Handle are passed to the File's functions with a
+// context from which the Handle can be retrieved using HandleFromContext.
+type Handle struct {
+	// The File that was opened.
+	File *File
+
+	// The flags the File was opened with.
+	Flags fuse.OpenFlags
+
+	// State can be used by the File's element to store anything relating to
+	// the open file.
+	State interface{}
+
+	// The process which opened the Handle, and whether a truncation to zero
+	// length has been deferred until it is written to or flushed. These are
+	// guarded by the File's Lock.
+	pid       uint32
+	truncated bool
+
+	// The value the Handle's reads are served from once captured when the
+	// File's Snapshot is set. The ID of the Handle is only known once it has
+	// served a request, and is recorded on the File so that Getattr can report
+	// the size of the captured value. When both are needed, the File's Lock is
+	// taken first.
+	mu         sync.Mutex
+	snapshot   []byte
+	captured   bool
+	id         fuse.HandleID
+	registered bool
+}
+
+// The HandleElement interface can be implemented by a FileElement to be
+// notified when the File is opened and released, so that it can set up and
+// tear down the State of each Handle.
+type HandleElement interface {
+	FileElement
+
+	// OpenHandle is called when the File is opened, before the Handle is
+	// used. If it returns an error, the open fails with that error.
+	OpenHandle(ctx context.Context, h *Handle) error
+
+	// ReleaseHandle is called once the Handle is closed, and won't be used
+	// again.
+	ReleaseHandle(ctx context.Context, h *Handle) error
+}
+
+// handleServer is implemented by elements which serve the reads, writes and
+// flushes made through each Handle themselves, such as the element of
+// NewRPCFile. They are called without the File's Lock held, after the Handle
+// has checked the File's Mode.
+type handleServer interface {
+	HandleElement
+
+	readHandle(ctx context.Context, h *Handle, req *fuse.ReadRequest, resp *fuse.ReadResponse) error
+	writeHandle(ctx context.Context, h *Handle, req *fuse.WriteRequest, resp *fuse.WriteResponse) error
+	flushHandle(ctx context.Context, h *Handle) error
+}
+
+var (
+	_ fs.HandleReader   = (*Handle)(nil)
+	_ fs.HandleWriter   = (*Handle)(nil)
+	_ fs.HandleFlusher  = (*Handle)(nil)
+	_ fs.HandleReleaser = (*Handle)(nil)
+	_ fs.NodeGetattrer  = (*File)(nil)
+)
+
+// handleContextKey is the key used to store the Handle serving a request in
+// its context.
+type handleContextKey struct{}
+
+// HandleFromContext returns the Handle serving the request the given context
+// belongs to, or nil if the request wasn't made through a Handle.
+func HandleFromContext(ctx context.Context) *Handle {
+	h, _ := ctx.Value(handleContextKey{}).(*Handle)
+	return h
+}
+
+// context returns a copy of ctx from which the Handle can be retrieved.
+func (h *Handle) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, handleContextKey{}, h)
+}
+
+// capture reads the File's value to serve the Handle's reads from.
+func (h *Handle) capture(ctx context.Context) error {
+	h.File.Lock.RLock()
+	defer h.File.Lock.RUnlock()
+	data, err := h.File.Element.ValRead(h.context(ctx))
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshot, h.captured = data, true
+	return nil
+}
+
+// register records the Handle on its File under the given ID, if its reads
+// are served from a captured value.
+func (h *Handle) register(id fuse.HandleID) {
+	h.mu.Lock()
+	done := h.registered || !h.captured
+	h.mu.Unlock()
+	if done {
+		return
+	}
+
+	h.File.Lock.Lock()
+	defer h.File.Lock.Unlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.File.snapshots == nil {
+		h.File.snapshots = make(map[fuse.HandleID]*Handle)
+	}
+	h.File.snapshots[id] = h
+	h.id, h.registered = id, true
+}
+
+// snapshotSize returns the length of the value captured for the Handle, and
+// whether there is one.
+func (h *Handle) snapshotSize() (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return uint64(len(h.snapshot)), h.captured
+}
+
+// Read passes the request to the File's Read function, or serves it from the
+// value captured when the File was opened if Snapshot is set.
+func (h *Handle) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	if s, ok := h.File.Element.(handleServer); ok {
+		if h.File.Mode&0444 == 0 {
+			return fuse.EPERM
+		}
+		return s.readHandle(h.context(ctx), h, req, resp)
+	}
+
+	h.register(req.Handle)
+	h.mu.Lock()
+	data, captured := h.snapshot, h.captured
+	h.mu.Unlock()
+	if !captured {
+		return h.File.Read(h.context(ctx), req, resp)
+	}
+
+	resp.Data = readAt(data, req.Offset, req.Size)
+	return nil
+}
+
+// Write passes the request to the File's Write function. If the Handle's
+// reads are served from a captured value, it is captured again once the write
+// succeeds, so that the Handle reads what it has written.
+func (h *Handle) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if s, ok := h.File.Element.(handleServer); ok {
+		if h.File.Mode&0222 == 0 {
+			return fuse.EPERM
+		}
+		return s.writeHandle(h.context(ctx), h, req, resp)
+	}
+
+	h.register(req.Handle)
+	if err := h.File.Write(h.context(ctx), req, resp); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	captured := h.captured
+	h.mu.Unlock()
+	if captured {
+		return h.capture(ctx)
+	}
+	return nil
+}
+
+// Flush passes the request to the File's Flush function.
+func (h *Handle) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	if s, ok := h.File.Element.(handleServer); ok {
+		return s.flushHandle(h.context(ctx), h)
+	}
+	return h.File.Flush(h.context(ctx), req)
+}
+
+// Release passes the request to the File's Release function, and then calls
+// ReleaseHandle if the File's element is a HandleElement.
+func (h *Handle) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	h.File.Lock.Lock()
+	h.mu.Lock()
+	if h.registered {
+		delete(h.File.snapshots, h.id)
+	}
+	h.mu.Unlock()
+	h.File.Lock.Unlock()
+
+	ctx = h.context(ctx)
+	err := h.File.Release(ctx, req)
+	if e, ok := h.File.Element.(HandleElement); ok {
+		if rerr := e.ReleaseHandle(ctx, h); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
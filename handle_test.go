@@ -0,0 +1,125 @@
+package fusebox
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+// handleTestElement numbers each handle it is opened with, and reads the
+// number of the handle being read from.
+type handleTestElement struct {
+	mu       sync.Mutex
+	opened   int
+	released []int
+	fail     bool
+}
+
+func (e *handleTestElement) OpenHandle(ctx context.Context, h *Handle) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.fail {
+		return fuse.Errno(syscall.EBUSY)
+	}
+
+	e.opened++
+	h.State = e.opened
+	return nil
+}
+
+func (e *handleTestElement) ReleaseHandle(ctx context.Context, h *Handle) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.released = append(e.released, h.State.(int))
+	return nil
+}
+
+func (e *handleTestElement) ValRead(ctx context.Context) ([]byte, error) {
+	h := HandleFromContext(ctx)
+	if h == nil {
+		return []byte("none"), nil
+	}
+	return []byte(fmt.Sprintf("handle %v", h.State)), nil
+}
+
+func (e *handleTestElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	return fuse.EPERM
+}
+
+func (e *handleTestElement) Size(ctx context.Context) (uint64, error) {
+	return uint64(len("handle 0")), nil
+}
+
+func TestHandles(t *testing.T) {
+	e := &handleTestElement{}
+	f := NewFile(e)
+	f.OpenFlags = fuse.OpenDirectIO
+
+	name := "handles"
+	if err := rootdir.AddNode(name, f); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	t.Run("per open state", func(t *testing.T) {
+		first, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+
+		second, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+
+		for i, file := range []*os.File{first, second} {
+			expected := fmt.Sprintf("handle %v", i+1)
+			data, err := ioutil.ReadAll(file)
+			if err != nil {
+				t.Fatalf("failed to read node: %v", err)
+			}
+
+			if string(data) != expected {
+				t.Errorf("incorrect value read, expected '%v', got '%s'", expected, data)
+			}
+		}
+
+		first.Close()
+		second.Close()
+	})
+
+	t.Run("release", func(t *testing.T) {
+		// Releases are sent asynchronously after the file is closed.
+		var released int
+		for i := 0; i < 100 && released < 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+			e.mu.Lock()
+			released = len(e.released)
+			e.mu.Unlock()
+		}
+
+		if released != 2 {
+			t.Errorf("incorrect number of handles released, expected 2, got %v", released)
+		}
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		e.mu.Lock()
+		e.fail = true
+		e.mu.Unlock()
+
+		_, err := os.Open(path)
+		if !checkError(err, fuse.Errno(syscall.EBUSY)) {
+			t.Errorf("incorrect error opening node, expected %v, got %v", fuse.Errno(syscall.EBUSY), err)
+		}
+	})
+}
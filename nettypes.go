@@ -0,0 +1,96 @@
+package fusebox
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NewIPFile returns a File which has an element that reads and updates the
+// given net.IP pointer. Both IPv4 and IPv6 addresses are accepted, as with
+// net.ParseIP. A nil IP is displayed as an empty string.
+func NewIPFile(ip *net.IP) *File {
+	return NewValueFile(ip, parseIP, formatIP)
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %v", s)
+	}
+	return ip, nil
+}
+
+func formatIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// NewIPNetFile returns a File which has an element that reads and updates the
+// given net.IPNet pointer. Values are displayed and parsed in CIDR notation,
+// such as "192.168.0.0/16", as with net.ParseCIDR. A zero IPNet is displayed as
+// an empty string.
+func NewIPNetFile(n *net.IPNet) *File {
+	parse := func(s string) (net.IPNet, error) {
+		_, ret, err := net.ParseCIDR(s)
+		if err != nil {
+			return net.IPNet{}, err
+		}
+		return *ret, nil
+	}
+
+	format := func(n net.IPNet) string {
+		return formatIPNet(&n)
+	}
+
+	return NewValueFile(n, parse, format)
+}
+
+func formatIPNet(n *net.IPNet) string {
+	if n.IP == nil {
+		return ""
+	}
+	return n.String()
+}
+
+// NewIPNetListFile returns a File which has an element that reads and updates
+// the given slice of networks, such as an allow-list, with one network per line
+// in CIDR notation. A plain IP address is also accepted, and is treated as a
+// network containing only that address. See NewSliceFile.
+func NewIPNetListFile(l *[]*net.IPNet) *File {
+	return NewSliceFile(l, parseIPNetEntry, formatIPNet)
+}
+
+func parseIPNetEntry(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ret, err := net.ParseCIDR(s)
+		return ret, err
+	}
+
+	ip, err := parseIP(s)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// NewHostPortFile returns a File which has an element that reads and updates
+// the given string, which holds an address of the form "host:port", such as a
+// listen address. Written values must be accepted by net.SplitHostPort.
+func NewHostPortFile(s *string) *File {
+	parse := func(s string) (string, error) {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+
+	return NewValueFile(s, parse, formatString)
+}
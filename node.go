@@ -4,6 +4,8 @@ import (
 	"context"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"bazil.org/fuse"
 	"bazil.org/fuse/fs"
@@ -11,8 +13,8 @@ import (
 
 // File represents a file in the virtualfilesystem. Reading and writing is handled
 // by the ValRead and ValWrite functions, which normally read and write to an
-// underlying go variable. It should be possible to read from the Change channel
-// whenever the data is changed.
+// underlying go variable. Changes made through the filesystem can be received
+// by using Subscribe.
 type File struct {
 	// The file mode.
 	Mode os.FileMode
@@ -21,7 +23,10 @@ type File struct {
 	OpenFlags fuse.OpenResponseFlags
 
 	// A channel that is written to when the value is updated to notify of
-	// a change.
+	// a change, if anything is receiving from it at the time.
+	//
+	// Deprecated: Change can only notify a single listener, and changes are
+	// lost if nothing is receiving. Use Subscribe instead.
 	Change chan int
 
 	// A lock used to synchronise reads/writes
@@ -29,6 +34,68 @@ type File struct {
 
 	// The Element is used to interact with the underlying data.
 	Element FileElement
+
+	// Validators are run on each value written to the file before it is
+	// assigned. See Validator.
+	Validators []Validator
+
+	// If Stream is set, the Element is treated as a stream of data rather
+	// than a value, and the offsets of reads and writes are ignored.
+	Stream bool
+
+	// If Buffered is set, writes to each open handle are collected and only
+	// passed to the Element once the handle is flushed, synced or released,
+	// so that a value written in several calls is parsed as a whole. It has
+	// no effect if Stream is set.
+	Buffered bool
+
+	// If Volatile is set, the kernel is told not to cache the file's
+	// attributes, so that the size is requested from the Element whenever it
+	// is needed. This suits elements whose value can change at any time
+	// without Touch being called.
+	Volatile bool
+
+	// If Snapshot is set, the value is read once when the file is opened,
+	// and every read through that open file is served from the captured
+	// value, so that readers see a consistent value while it is being
+	// changed. Writes through the open file replace its captured value. The
+	// size reported by Getattr through the open file is that of the captured
+	// value once the open file has been read from or written to. As the
+	// kernel doesn't request attributes through the open file for every
+	// read, the file is also opened with direct IO, so that reads end with
+	// the captured value rather than at the size last reported for the file.
+	// It has no effect if Stream is set.
+	Snapshot bool
+
+	// The handles opened for writing which haven't yet been written to or
+	// flushed. Truncations made when opening with O_TRUNC don't identify the
+	// handle, so a truncation to zero length by the process which opened one
+	// of these is deferred until the handle is written to or flushed.
+	opening []*Handle
+
+	// The handles whose reads are served from a value captured because
+	// Snapshot is set, by the ID they have served requests with.
+	snapshots map[fuse.HandleID]*Handle
+
+	// The data written to each handle when Buffered is set.
+	buffers map[fuse.HandleID][]byte
+
+	// The subscriptions to changes to the file, and the path reported to
+	// each.
+	subsMu sync.Mutex
+	subs   map[*Subscription]string
+
+	// A channel which is closed and replaced whenever the file changes, and
+	// the number of changes so far.
+	changed    chan struct{}
+	generation uint64
+
+	// The inode number reported for the file, which is assigned when its
+	// attributes are first requested.
+	inode uint64
+
+	// The filesystems the file has been served from.
+	mounts
 }
 
 // The FileElement interface is used by File to interact with the underlying data.
@@ -53,6 +120,42 @@ type FileElement interface {
 	Size(ctx context.Context) (uint64, error)
 }
 
+// The ValueElement interface can be implemented by a FileElement to separate
+// parsing written data from assigning it to the underlying data, which allows
+// the File's Validators to check the parsed value in between.
+type ValueElement interface {
+	FileElement
+
+	// Parse should convert the given data into a value which can be passed
+	// to Assign, or return an error to be returned from Write. The
+	// underlying data must not be modified.
+	Parse(data []byte) (interface{}, error)
+
+	// Assign should set the underlying data to the given value, which was
+	// returned by Parse.
+	Assign(v interface{})
+}
+
+// appendElement is implemented by elements whose written data can describe a
+// change to the current value, such as the additions and removals accepted by
+// NewSetFile. Data appended to the File with O_APPEND is converted using
+// appendData and written in place of the value, rather than being spliced onto
+// the current value, so that the current value doesn't need to be parsed back
+// from its displayed form. If appendData returns nil, the value is left
+// unchanged.
+type appendElement interface {
+	FileElement
+	appendData(data []byte) []byte
+}
+
+// A Validator checks a value written to a File before it is assigned. If the
+// File's Element implements ValueElement, v is the value returned by its Parse
+// function, otherwise it is the written []byte. Returning an error rejects the
+// write and leaves the underlying data unchanged. The error is returned from
+// Write, so a fuse.Errno such as fuse.Errno(syscall.EINVAL) can be used to set
+// the errno seen by the writer, while other errors are reported as EIO.
+type Validator func(v interface{}) error
+
 var _ VarNodeable = (*File)(nil)
 
 // NewFile returns a new file based on the given FileElement. This FileElement
@@ -66,16 +169,78 @@ func NewFile(e FileElement) *File {
 	}
 }
 
+// The defaults bazil.org/fuse/fs uses for the attributes of nodes which don't
+// implement fs.NodeGetattrer, which File.Getattr also uses.
+const attrValidTime = time.Minute
+
+var startTime = time.Now()
+
+// lastInode is the inode number most recently assigned to a File.
+var lastInode uint64 = 1
+
 // Attr returns the attributes of the file. These are displayed to the filesystem,
 // and should usually be enforced. This is implemented to implement the fs.Node
 // interface.
 func (f *File) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Mode = f.Mode
+	attr.Inode = f.inodeNumber()
+	f.Lock.RLock()
 	l, err := f.Element.Size(ctx)
+	f.Lock.RUnlock()
 	if err != nil {
 		return err
 	}
 	attr.Size = l
+	if f.Volatile {
+		attr.Valid = 0
+	}
+	return nil
+}
+
+// inodeNumber returns the inode number of the file, assigning it if needed.
+// Files are given their own numbers, so that the number reported is the same
+// whether the attributes are requested with a lookup or through Getattr.
+func (f *File) inodeNumber() uint64 {
+	if ino := atomic.LoadUint64(&f.inode); ino != 0 {
+		return ino
+	}
+
+	atomic.CompareAndSwapUint64(&f.inode, 0, atomic.AddUint64(&lastInode, 1))
+	return atomic.LoadUint64(&f.inode)
+}
+
+// Getattr returns the attributes of the file as with Attr, except that when
+// they are requested through a handle whose reads are served from a value
+// captured because Snapshot is set, the size is that of the captured value.
+// The attributes aren't cached in that case, as they only apply to the
+// handle. This is implemented to implement the fs.NodeGetattrer interface.
+func (f *File) Getattr(ctx context.Context, req *fuse.GetattrRequest, resp *fuse.GetattrResponse) error {
+	// These are otherwise filled in by bazil.org/fuse/fs before calling Attr.
+	resp.Attr.Valid = attrValidTime
+	resp.Attr.Nlink = 1
+	resp.Attr.Atime = startTime
+	resp.Attr.Mtime = startTime
+	resp.Attr.Ctime = startTime
+	resp.Attr.Crtime = startTime
+	if err := f.Attr(ctx, &resp.Attr); err != nil {
+		return err
+	}
+
+	if req.Flags&fuse.GetattrFh == 0 {
+		return nil
+	}
+
+	f.Lock.RLock()
+	h := f.snapshots[req.Handle]
+	f.Lock.RUnlock()
+	if h == nil {
+		return nil
+	}
+
+	if size, ok := h.snapshotSize(); ok {
+		resp.Attr.Size = size
+		resp.Attr.Valid = 0
+	}
 	return nil
 }
 
@@ -85,9 +250,10 @@ func (f *File) DirentType() fuse.DirentType {
 	return fuse.DT_File
 }
 
-// Read returns all the data from the File's element by calling its ValRead
-// function. This function also makes a RLock and RUnlock calls to the Lock, as
-// well as checking the permissions from the value of Mode.
+// Read returns the data from the File's element by calling its ValRead
+// function, starting from the offset of the request. This function also makes
+// a RLock and RUnlock calls to the Lock, as well as checking the permissions
+// from the value of Mode.
 func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
 	if f.Mode&0444 == 0 {
 		return fuse.EPERM
@@ -96,34 +262,392 @@ func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadR
 	f.Lock.RLock()
 	defer f.Lock.RUnlock()
 	data, err := f.Element.ValRead(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !f.Stream {
+		data = readAt(data, req.Offset, req.Size)
+	}
 	resp.Data = data
-	return err
+	return nil
 }
 
 // Write writes the data to the File's element by calling its ValWrite function.
-// If the Change channel is not empty, a value is  sent through it to signal a
-// change in the data to any listening routines. This function also makes Lock and
-// Unlock calls to the Lock, as well as checking permissions from the value of Mode.
+// A write at offset zero replaces the value, while a write at a non-zero
+// offset, or to a file opened with O_APPEND, is spliced into the current value
+// first, unless the data is appended to an element which accepts it as a
+// change to the current value. If Buffered is set, the data is instead held until the handle is
+// flushed. Successful changes to the data are sent to any Subscriptions to the
+// File, as well as through the Change channel. This function also
+// makes Lock and Unlock calls to the Lock, as well as checking permissions from
+// the value of Mode.
 func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
 	if f.Mode&0222 == 0 {
 		return fuse.EPERM
 	}
 
-	defer func() {
-		select {
-		case f.Change <- 1:
-		default:
+	f.Lock.Lock()
+	defer f.Lock.Unlock()
+	truncated := f.resolveTruncation(HandleFromContext(ctx))
+	if f.Buffered && !f.Stream {
+		return f.bufferWrite(ctx, req, resp, truncated)
+	}
+
+	if f.Stream || (req.Offset == 0 && req.FileFlags&fuse.OpenAppend == 0) {
+		return f.valWrite(ctx, req, resp)
+	}
+
+	if e, ok := f.Element.(appendElement); ok && req.FileFlags&fuse.OpenAppend != 0 {
+		appended := *req
+		appended.Offset = 0
+		appended.Data = e.appendData(req.Data)
+		if appended.Data == nil {
+			resp.Size = len(req.Data)
+			return nil
+		}
+
+		if err := f.valWrite(ctx, &appended, resp); err != nil {
+			return err
+		}
+
+		resp.Size = len(req.Data)
+		return nil
+	}
+
+	var cur []byte
+	if !truncated {
+		var err error
+		cur, err = f.Element.ValRead(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	off := req.Offset
+	if req.FileFlags&fuse.OpenAppend != 0 {
+		off = int64(len(cur))
+	}
+
+	spliced := *req
+	spliced.Offset = 0
+	spliced.Data = splice(cur, off, req.Data)
+	if err := f.valWrite(ctx, &spliced, resp); err != nil {
+		return err
+	}
+
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// valWrite passes the write request to the File's element, and notifies any
+// subscribers of the change if it succeeds. The caller must hold the Lock.
+func (f *File) valWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	subs := f.subscriptions()
+	var old []byte
+	if len(subs) > 0 && !f.Stream {
+		old, _ = f.Element.ValRead(ctx)
+	}
+
+	if err := f.validatedWrite(ctx, req, resp); err != nil {
+		return err
+	}
+
+	f.signalChange()
+	select {
+	case f.Change <- 1:
+	default:
+	}
+
+	if len(subs) == 0 {
+		return nil
+	}
+
+	ev := ChangeEvent{Old: old, New: req.Data, Uid: req.Uid, Pid: req.Pid}
+	if !f.Stream {
+		ev.New, _ = f.Element.ValRead(ctx)
+	}
+	for s, p := range subs {
+		ev.Path = p
+		s.send(ev)
+	}
+	return nil
+}
+
+// validatedWrite passes the write request to the File's element, first
+// checking the data with the File's Validators if there are any.
+func (f *File) validatedWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	if len(f.Validators) == 0 {
+		return f.Element.ValWrite(ctx, req, resp)
+	}
+
+	e, ok := f.Element.(ValueElement)
+	if !ok {
+		if err := f.validate(req.Data); err != nil {
+			return err
+		}
+		return f.Element.ValWrite(ctx, req, resp)
+	}
+
+	v, err := e.Parse(req.Data)
+	if err != nil {
+		return err
+	}
+
+	if err := f.validate(v); err != nil {
+		return err
+	}
+
+	e.Assign(v)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// validate runs each of the File's Validators on v, returning the first error.
+func (f *File) validate(v interface{}) error {
+	for _, validator := range f.Validators {
+		if err := validator(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bufferWrite splices the data from req into the buffer for its handle. The
+// buffer starts empty for a write at offset zero or following a truncation,
+// and from the current value otherwise. Data appended to an appendElement is
+// converted and added to the buffer instead. The caller must hold the Lock.
+func (f *File) bufferWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse, truncated bool) error {
+	if f.buffers == nil {
+		f.buffers = make(map[fuse.HandleID][]byte)
+	}
+
+	buf, ok := f.buffers[req.Handle]
+	if e, isAppend := f.Element.(appendElement); isAppend && req.FileFlags&fuse.OpenAppend != 0 {
+		f.buffers[req.Handle] = append(buf, e.appendData(req.Data)...)
+		resp.Size = len(req.Data)
+		return nil
+	}
+
+	if !ok && !truncated && (req.Offset != 0 || req.FileFlags&fuse.OpenAppend != 0) {
+		cur, err := f.Element.ValRead(ctx)
+		if err != nil {
+			return err
+		}
+		buf = cur
+	}
+
+	off := req.Offset
+	if req.FileFlags&fuse.OpenAppend != 0 {
+		off = int64(len(buf))
+	}
+
+	f.buffers[req.Handle] = splice(buf, off, req.Data)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// commit passes any data buffered for the given handle to the File's element,
+// returning the error from its ValWrite function. The caller must hold the
+// Lock.
+func (f *File) commit(ctx context.Context, header fuse.Header, h fuse.HandleID) error {
+	buf, ok := f.buffers[h]
+	if !ok {
+		return nil
+	}
+
+	delete(f.buffers, h)
+	req := &fuse.WriteRequest{Header: header, Handle: h, Data: buf}
+	return f.valWrite(ctx, req, &fuse.WriteResponse{})
+}
+
+// Setattr handles changes to the size of the file. A truncation to zero length
+// by a process which has just opened the file for writing, as happens when it
+// is opened with O_TRUNC, is deferred until that handle is written to or
+// flushed, so that a following write through it simply replaces the value.
+// Any other size is applied immediately by truncating or padding the current
+// value.
+func (f *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	if !req.Valid.Size() || f.Stream {
+		return nil
+	}
+
+	if f.Mode&0222 == 0 {
+		return fuse.EPERM
+	}
+
+	f.Lock.Lock()
+	defer f.Lock.Unlock()
+	if req.Size == 0 && f.deferTruncation(req.Pid) {
+		return nil
+	}
+
+	cur, err := f.Element.ValRead(ctx)
+	if err != nil {
+		return err
+	}
+
+	if uint64(len(cur)) == req.Size {
+		return nil
+	}
+
+	var data []byte
+	if uint64(len(cur)) > req.Size {
+		data = cur[:req.Size]
+	} else {
+		data = splice(cur, int64(req.Size), nil)
+	}
+
+	wreq := &fuse.WriteRequest{Header: req.Header, Data: data}
+	return f.valWrite(ctx, wreq, &fuse.WriteResponse{})
+}
+
+// Flush commits any data buffered for the handle, so that errors from parsing
+// it are returned from close(2). Otherwise, an empty value is written to the
+// File's element if a truncation to zero length was deferred until the handle
+// was flushed.
+func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	f.Lock.Lock()
+	defer f.Lock.Unlock()
+	if err := f.commit(ctx, req.Header, req.Handle); err != nil {
+		return err
+	}
+
+	if !f.resolveTruncation(HandleFromContext(ctx)) {
+		return nil
+	}
+
+	return f.valWrite(ctx, &fuse.WriteRequest{Header: req.Header}, &fuse.WriteResponse{})
+}
+
+// deferTruncation defers a truncation to zero length made by the process with
+// the given pid to the handle it most recently opened for writing, returning
+// false if there isn't one which is yet to be written to or flushed. The
+// caller must hold the Lock.
+func (f *File) deferTruncation(pid uint32) bool {
+	for i := len(f.opening) - 1; i >= 0; i-- {
+		if h := f.opening[i]; h.pid == pid {
+			f.forgetOpening(h)
+			h.truncated = true
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTruncation marks the given handle as having been written to or
+// flushed, returning whether a truncation to zero length was deferred until
+// then. The caller must hold the Lock.
+func (f *File) resolveTruncation(h *Handle) bool {
+	if h == nil {
+		return false
+	}
+
+	f.forgetOpening(h)
+	truncated := h.truncated
+	h.truncated = false
+	return truncated
+}
+
+// forgetOpening removes the given handle from those which can have a
+// truncation deferred to them. The caller must hold the Lock.
+func (f *File) forgetOpening(h *Handle) {
+	for i, o := range f.opening {
+		if o == h {
+			f.opening = append(f.opening[:i], f.opening[i+1:]...)
+			return
 		}
-	}()
+	}
+}
+
+// readAt returns at most size bytes of data, starting from the given offset.
+func readAt(data []byte, off int64, size int) []byte {
+	if off >= int64(len(data)) {
+		return nil
+	}
+
+	data = data[off:]
+	if len(data) > size {
+		data = data[:size]
+	}
+	return data
+}
+
+// splice returns a copy of cur with data written at the given offset. Any gap
+// between the end of cur and the offset is filled with spaces, which are
+// trimmed by the built-in elements.
+func splice(cur []byte, off int64, data []byte) []byte {
+	end := off + int64(len(data))
+	if end < int64(len(cur)) {
+		end = int64(len(cur))
+	}
+
+	ret := make([]byte, end)
+	n := copy(ret, cur)
+	for i := int64(n); i < off; i++ {
+		ret[i] = ' '
+	}
+	copy(ret[off:], data)
+	return ret
+}
 
+// Release commits any data still buffered for the handle. It is implemented
+// to implement the fs.HandleReleaser interface.
+func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
 	f.Lock.Lock()
 	defer f.Lock.Unlock()
-	return f.Element.ValWrite(ctx, req, resp)
+	f.resolveTruncation(HandleFromContext(ctx))
+	return f.commit(ctx, req.Header, req.Handle)
 }
 
-// Fsync is implemented to implement the fs.NodeFsyncer interface
-func (*File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
-	return nil
+// Fsync commits any data buffered for the handle. It is implemented to
+// implement the fs.NodeFsyncer interface
+func (f *File) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	f.Lock.Lock()
+	defer f.Lock.Unlock()
+	return f.commit(ctx, req.Header, req.Handle)
+}
+
+// Touch invalidates the kernel's cache of the file's data and attributes in
+// every filesystem it has been served from, as well as the cache of a
+// CachedElement, and wakes any readers waiting on a WatchFile for it. This
+// should be called after the underlying data is changed by go code, so that
+// the change is seen immediately by readers of the filesystem.
+func (f *File) Touch() {
+	if c, ok := f.Element.(*CachedElement); ok {
+		c.Invalidate()
+	}
+
+	f.signalChange()
+
+	// Invalidation is best effort: it fails if the filesystem has since been
+	// unmounted, and there is nothing more Touch could do about other errors.
+	for _, m := range f.filesystems() {
+		_ = m.Invalidate(f)
+	}
+}
+
+// changeSignal returns a channel which is closed at the next change to the
+// file, along with the number of changes made so far.
+func (f *File) changeSignal() (<-chan struct{}, uint64) {
+	f.subsMu.Lock()
+	defer f.subsMu.Unlock()
+	if f.changed == nil {
+		f.changed = make(chan struct{})
+	}
+	return f.changed, f.generation
+}
+
+// signalChange counts a change to the file, and closes the channel returned
+// by changeSignal, waking anything waiting on it.
+func (f *File) signalChange() {
+	f.subsMu.Lock()
+	defer f.subsMu.Unlock()
+	f.generation++
+	if f.changed != nil {
+		close(f.changed)
+		f.changed = nil
+	}
 }
 
 // Node returns the File itself. It is implemented to implement the VarNodeable
@@ -132,9 +656,39 @@ func (f *File) Node() VarNode {
 	return f
 }
 
-// Open returns the File as the handle, as well as setting and OpenFlags in the
-// response.
+// Open returns a new Handle for the File, as well as setting the OpenFlags in
+// the response. If the File's element is a HandleElement, its OpenHandle
+// function is called with the new Handle.
 func (f *File) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	h := &Handle{File: f, Flags: req.Flags, pid: req.Pid}
+	if e, ok := f.Element.(HandleElement); ok {
+		if err := e.OpenHandle(h.context(ctx), h); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Snapshot && !f.Stream {
+		if f.Mode&0444 != 0 && !req.Flags.IsWriteOnly() {
+			if err := h.capture(ctx); err != nil {
+				// The error from the capture is returned in preference to
+				// any from releasing the handle.
+				if e, ok := f.Element.(HandleElement); ok {
+					_ = e.ReleaseHandle(h.context(ctx), h)
+				}
+				return nil, err
+			}
+		}
+		resp.Flags |= fuse.OpenDirectIO
+	}
+
+	// The handle is only recorded once the open can no longer fail, so that
+	// truncations aren't deferred to a handle which is never used.
+	if !f.Stream && !req.Flags.IsReadOnly() {
+		f.Lock.Lock()
+		f.opening = append(f.opening, h)
+		f.Lock.Unlock()
+	}
+
 	resp.Flags |= f.OpenFlags
-	return f, nil
+	return h, nil
 }
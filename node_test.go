@@ -2,18 +2,33 @@ package fusebox
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"path"
 	"reflect"
 	"regexp"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	"bazil.org/fuse"
 )
 
+func parseTestCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
 func TestFiles(t *testing.T) {
 	type testList []struct {
 		writeVal []byte
@@ -31,8 +46,39 @@ func TestFiles(t *testing.T) {
 		testChan   chan int
 		testRegexp regexp.Regexp
 		testURL    url.URL
+		testIP     net.IP
+		testLevel  string
+		testInt8   int8
+		testUint   uint
+		testUint8  uint8
+		testFloat  float64
+		testFixed  float32
+		testDur    time.Duration
+		testTime   time.Time
+		testLoc    *time.Location
+		testSize   int64
+		testDSize  int
+		testRate   float64
+		testPct    float64
+		testIntPct int
+		testIP2    net.IP
+		testIPNet  net.IPNet
+		testNets   []*net.IPNet
+		testAddr   string
+		testStrs   []string
+		testInts   []int
 	)
 
+	parseLevel := func(s string) (string, error) {
+		if s != "low" && s != "high" {
+			return "", fmt.Errorf("invalid level: %v", s)
+		}
+		return s, nil
+	}
+	formatLevel := func(s string) string {
+		return "level: " + s
+	}
+
 	var testURLs = make([]url.URL, 0)
 	for _, v := range []string{"http://example.com"} {
 		u, _ := url.Parse(v)
@@ -105,6 +151,164 @@ func TestFiles(t *testing.T) {
 		tests: testList{
 			{[]byte("http://example.com"), []byte("http://example.com"), testURLs[0], nil, nil},
 		},
+	}, {
+		v:    &testIP,
+		node: NewTextFile(&testIP),
+		tests: testList{
+			{[]byte("127.0.0.1"), []byte("127.0.0.1"), net.ParseIP("127.0.0.1"), nil, nil},
+			{[]byte("::1\n"), []byte("::1"), net.ParseIP("::1"), nil, nil},
+			{[]byte("abc"), []byte("10.0.0.1"), net.ParseIP("10.0.0.1"), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testLevel,
+		node: NewValueFile(&testLevel, parseLevel, formatLevel),
+		tests: testList{
+			{[]byte("low\n"), []byte("level: low"), "low", nil, nil},
+			{[]byte("high"), []byte("level: high"), "high", nil, nil},
+			{[]byte("medium"), []byte("level: low"), "low", fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testInt8,
+		node: NewInt8File(&testInt8),
+		tests: testList{
+			{[]byte("-128\n"), []byte("-128"), int8(-128), nil, nil},
+			{[]byte("128"), []byte("-128"), int8(-128), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testUint,
+		node: NewUintFile(&testUint),
+		tests: testList{
+			{[]byte("100"), []byte("100"), uint(100), nil, nil},
+			{[]byte("-1"), []byte("100"), uint(100), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testUint8,
+		node: NewUint8File(&testUint8),
+		tests: testList{
+			{[]byte("255"), []byte("255"), uint8(255), nil, nil},
+			{[]byte("300"), []byte("255"), uint8(255), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testFloat,
+		node: NewFloat64File(&testFloat),
+		tests: testList{
+			{[]byte("1.5\n"), []byte("1.5"), 1.5, nil, nil},
+			{[]byte("1e400"), []byte("1.5"), 1.5, fuse.ERANGE, nil},
+			{[]byte("abc"), []byte("1.5"), 1.5, fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testFixed,
+		node: NewFloat32FileFormat(&testFixed, 'f', 2),
+		tests: testList{
+			{[]byte("3.14159"), []byte("3.14"), float32(3.14159), nil, nil},
+			{[]byte("1e39"), []byte("3.14"), float32(3.14159), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testDur,
+		node: NewDurationFile(&testDur),
+		tests: testList{
+			{[]byte("1m30s\n"), []byte("1m30s"), 90 * time.Second, nil, nil},
+			{[]byte("90"), []byte("1m30s"), 90 * time.Second, fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testTime,
+		node: NewTimeFile(&testTime),
+		tests: testList{
+			{[]byte("2020-01-02T03:04:05Z"), []byte("2020-01-02T03:04:05Z"), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), nil, nil},
+			{[]byte("1000000000"), []byte(time.Unix(1000000000, 0).Format(time.RFC3339)), time.Unix(1000000000, 0), nil, nil},
+			{[]byte("yesterday"), []byte("2020-01-02T03:04:05Z"), time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testLoc,
+		node: NewLocationFile(&testLoc),
+		tests: testList{
+			{[]byte("UTC\n"), []byte("UTC"), time.UTC, nil, nil},
+			{[]byte("Nowhere/Special"), []byte("UTC"), time.UTC, fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testSize,
+		node: NewByteSizeFile(&testSize, BinaryBytes),
+		tests: testList{
+			{[]byte("10MiB\n"), []byte("10MiB"), int64(10 << 20), nil, nil},
+			{[]byte("1536"), []byte("1.5KiB"), int64(1536), nil, nil},
+			{[]byte("2 kb"), []byte("1.953125KiB"), int64(2000), nil, nil},
+			{[]byte("10XB"), []byte("1.953125KiB"), int64(2000), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testDSize,
+		node: NewByteSizeFile(&testDSize, DecimalBytes),
+		tests: testList{
+			{[]byte("1.5GB"), []byte("1.5GB"), 1500000000, nil, nil},
+			{[]byte("12"), []byte("12B"), 12, nil, nil},
+			{[]byte("-1"), []byte("-1B"), -1, nil, nil},
+		},
+	}, {
+		v:    &testRate,
+		node: NewRateFile(&testRate, time.Second),
+		tests: testList{
+			{[]byte("100/s"), []byte("100/s"), float64(100), nil, nil},
+			{[]byte("6000/m"), []byte("100/s"), float64(100), nil, nil},
+			{[]byte("5/10s"), []byte("0.5/s"), 0.5, nil, nil},
+			{[]byte("5/fortnight"), []byte("0.5/s"), 0.5, fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testPct,
+		node: NewPercentFile(&testPct, 1, -1),
+		tests: testList{
+			{[]byte("75%"), []byte("75%"), 0.75, nil, nil},
+			{[]byte("0.5"), []byte("50%"), 0.5, nil, nil},
+			{[]byte("lots%"), []byte("50%"), 0.5, fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testIntPct,
+		node: NewPercentFile(&testIntPct, 100, 0),
+		tests: testList{
+			{[]byte("42.4%"), []byte("42%"), 42, nil, nil},
+			{[]byte("1e30%"), []byte("42%"), 42, fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testIP2,
+		node: NewIPFile(&testIP2),
+		tests: testList{
+			{[]byte("10.0.0.1\n"), []byte("10.0.0.1"), net.ParseIP("10.0.0.1"), nil, nil},
+			{[]byte("10.0.0.256"), []byte("10.0.0.1"), net.ParseIP("10.0.0.1"), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testIPNet,
+		node: NewIPNetFile(&testIPNet),
+		tests: testList{
+			{[]byte("192.168.1.1/16"), []byte("192.168.0.0/16"), *parseTestCIDR("192.168.0.0/16"), nil, nil},
+			{[]byte("192.168.1.1"), []byte("192.168.0.0/16"), *parseTestCIDR("192.168.0.0/16"), fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testNets,
+		node: NewIPNetListFile(&testNets),
+		tests: testList{
+			{[]byte("10.0.0.0/8\n\n::1\n"), []byte("10.0.0.0/8\n::1/128\n"), []*net.IPNet{parseTestCIDR("10.0.0.0/8"), parseTestCIDR("::1/128")}, nil, nil},
+			{[]byte("172.16.0.0/12\nbad"), []byte("10.0.0.0/8\n::1/128\n"), []*net.IPNet{parseTestCIDR("10.0.0.0/8"), parseTestCIDR("::1/128")}, fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testAddr,
+		node: NewHostPortFile(&testAddr),
+		tests: testList{
+			{[]byte("localhost:8080\n"), []byte("localhost:8080"), "localhost:8080", nil, nil},
+			{[]byte("[::1]:53"), []byte("[::1]:53"), "[::1]:53", nil, nil},
+			{[]byte("localhost"), []byte("[::1]:53"), "[::1]:53", fuse.ERANGE, nil},
+		},
+	}, {
+		v:    &testStrs,
+		node: NewStringSliceFile(&testStrs),
+		tests: testList{
+			{[]byte("a\nb c\n\nd\n"), []byte("a\nb c\nd\n"), []string{"a", "b c", "d"}, nil, nil},
+			{[]byte("e"), []byte("e\n"), []string{"e"}, nil, nil},
+		},
+	}, {
+		v:    &testInts,
+		node: NewIntSliceFile(&testInts),
+		tests: testList{
+			{[]byte("1\n-2\n 3 \n"), []byte("1\n-2\n3\n"), []int{1, -2, 3}, nil, nil},
+			{[]byte("4\nfive\n6"), []byte("1\n-2\n3\n"), []int{1, -2, 3}, fuse.ERANGE, nil},
+		},
 	}}
 
 	for _, tt := range typeTests {
@@ -197,3 +401,982 @@ func TestFiles(t *testing.T) {
 		rootdir.RemoveNode(name)
 	}
 }
+
+func TestFileOffsets(t *testing.T) {
+	var testString string
+	name := "offsets"
+	if err := rootdir.AddNode(name, NewStringFile(&testString)); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	t.Run("read at offset", func(t *testing.T) {
+		testString = "hello world"
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		buf := make([]byte, 3)
+		n, err := file.ReadAt(buf, 6)
+		if err != nil {
+			t.Fatalf("failed to read node: %v", err)
+		}
+
+		if !bytes.Equal(buf[:n], []byte("wor")) {
+			t.Errorf("incorrect value read at offset, expected 'wor', got '%s'", buf[:n])
+		}
+	})
+
+	t.Run("write at offset", func(t *testing.T) {
+		testString = "hello world"
+		file, err := os.OpenFile(path, os.O_WRONLY, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := file.WriteAt([]byte("there"), 6); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		if testString != "hello there" {
+			t.Errorf("incorrect value after writing at offset, expected 'hello there', got '%v'", testString)
+		}
+	})
+
+	t.Run("append", func(t *testing.T) {
+		testString = "hello"
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := file.Write([]byte(" world")); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		if testString != "hello world" {
+			t.Errorf("incorrect value after appending, expected 'hello world', got '%v'", testString)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		testString = "hello"
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+
+		if testString != "hello" {
+			t.Errorf("value changed before file was closed: '%v'", testString)
+		}
+
+		if err := file.Close(); err != nil {
+			t.Fatalf("failed to close node: %v", err)
+		}
+
+		if testString != "" {
+			t.Errorf("incorrect value after truncating, expected '', got '%v'", testString)
+		}
+	})
+
+	t.Run("truncate without handle", func(t *testing.T) {
+		testString = "hello"
+		if err := os.Truncate(path, 0); err != nil {
+			t.Fatalf("failed to truncate node: %v", err)
+		}
+
+		if testString != "" {
+			t.Errorf("incorrect value after truncating, expected '', got '%v'", testString)
+		}
+	})
+
+	t.Run("truncate with reader", func(t *testing.T) {
+		testString = "hello"
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		// Closing a reader mustn't apply the writer's truncation.
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read node: %v", err)
+		}
+
+		if string(data) != "hello" || testString != "hello" {
+			t.Errorf("value changed by reader before writer was closed: read '%s', value '%v'", data, testString)
+		}
+
+		if _, err := file.Write([]byte("bye")); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		if testString != "bye" {
+			t.Errorf("incorrect value after writing, expected 'bye', got '%v'", testString)
+		}
+	})
+}
+
+func TestBufferedFile(t *testing.T) {
+	var (
+		testString string
+		testInt    int
+	)
+
+	stringFile := NewStringFile(&testString)
+	stringFile.Buffered = true
+	intFile := NewIntFile(&testInt)
+	intFile.Buffered = true
+
+	tests := []struct {
+		name     string
+		node     *File
+		writes   [][]byte
+		closeErr error
+		value    func() interface{}
+		expected interface{}
+	}{
+		{"string", stringFile, [][]byte{[]byte("hello "), []byte("world\n")}, nil, func() interface{} { return testString }, "hello world"},
+		{"int", intFile, [][]byte{[]byte("12"), []byte("34")}, nil, func() interface{} { return testInt }, 1234},
+		{"invalid int", intFile, [][]byte{[]byte("12"), []byte("ab")}, fuse.ERANGE, func() interface{} { return testInt }, 1234},
+	}
+
+	for _, test := range tests {
+		name := "buffered"
+		if err := rootdir.AddNode(name, test.node); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+		path := path.Join(mountpoint, name)
+
+		t.Run(test.name, func(t *testing.T) {
+			file, err := os.OpenFile(path, os.O_WRONLY, 0666)
+			if err != nil {
+				t.Fatalf("failed to open node: %v", err)
+			}
+
+			before := test.value()
+			for _, w := range test.writes {
+				if _, err := file.Write(w); err != nil {
+					t.Errorf("failed to write '%s' to node: %v", w, err)
+				}
+
+				if test.value() != before {
+					t.Errorf("value changed before file was closed: %v", test.value())
+				}
+			}
+
+			err = file.Close()
+			if !checkError(err, test.closeErr) {
+				t.Errorf("incorrect error closing node, expected: %v, got: %v", test.closeErr, err)
+			}
+
+			if test.value() != test.expected {
+				t.Errorf("incorrect value after closing node, expected %v, got %v", test.expected, test.value())
+			}
+		})
+
+		rootdir.RemoveNode(name)
+	}
+}
+
+func TestValidators(t *testing.T) {
+	var (
+		testPort int
+		testHost string
+	)
+
+	portFile := NewIntFile(&testPort)
+	portFile.Validators = []Validator{func(v interface{}) error {
+		if v.(int) < 0 || v.(int) > 65535 {
+			return fuse.Errno(syscall.EINVAL)
+		}
+		return nil
+	}}
+
+	hostFile := NewStringFile(&testHost)
+	hostFile.Validators = []Validator{func(v interface{}) error {
+		if v.(string) == "" {
+			return fuse.Errno(syscall.EACCES)
+		}
+		return nil
+	}}
+
+	tests := []struct {
+		name     string
+		node     *File
+		writeVal []byte
+		writeErr error
+		value    func() interface{}
+		expected interface{}
+	}{
+		{"valid port", portFile, []byte("8080"), nil, func() interface{} { return testPort }, 8080},
+		{"invalid port", portFile, []byte("70000"), fuse.Errno(syscall.EINVAL), func() interface{} { return testPort }, 8080},
+		{"unparsable port", portFile, []byte("abc"), fuse.ERANGE, func() interface{} { return testPort }, 8080},
+		{"valid host", hostFile, []byte("example.com"), nil, func() interface{} { return testHost }, "example.com"},
+		{"empty host", hostFile, []byte("\n"), fuse.Errno(syscall.EACCES), func() interface{} { return testHost }, "example.com"},
+	}
+
+	for _, test := range tests {
+		name := "validated"
+		if err := rootdir.AddNode(name, test.node); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		t.Run(test.name, func(t *testing.T) {
+			file, err := os.OpenFile(path.Join(mountpoint, name), os.O_WRONLY, 0666)
+			if err != nil {
+				t.Fatalf("failed to open node: %v", err)
+			}
+			defer file.Close()
+
+			_, err = file.Write(test.writeVal)
+			if !checkError(err, test.writeErr) {
+				t.Errorf("incorrect error writing '%s' to node, expected: %v, got: %v", test.writeVal, test.writeErr, err)
+			}
+
+			if test.value() != test.expected {
+				t.Errorf("incorrect value after writing '%s', expected %v, got %v", test.writeVal, test.expected, test.value())
+			}
+		})
+
+		rootdir.RemoveNode(name)
+	}
+}
+
+func TestFileTouch(t *testing.T) {
+	var testString string
+	name := "touch"
+	f := NewStringFile(&testString)
+	if err := rootdir.AddNode(name, f); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+
+	testString = "a"
+	file, err := os.Open(path.Join(mountpoint, name))
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := ioutil.ReadAll(file); err != nil {
+		t.Fatalf("couldn't read file: %v", err)
+	}
+
+	testString = "hello world"
+	f.Touch()
+
+	file.Seek(0, 0)
+	r, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatalf("couldn't read file: %v", err)
+	}
+
+	if !bytes.Equal(r, []byte(testString)) {
+		t.Errorf("incorrect value read after touching file, expected '%v', got '%s'", testString, r)
+	}
+}
+
+func TestAtomicFiles(t *testing.T) {
+	var (
+		testInt32  atomic.Int32
+		testInt64  atomic.Int64
+		testUint64 atomic.Uint64
+		testBool   atomic.Bool
+		testValue  atomic.Value
+	)
+
+	valueFile := NewAtomicValueFile(&testValue, func(v interface{}) string {
+		if v == nil {
+			return ""
+		}
+		return v.(string)
+	}, func(s string) (interface{}, error) {
+		return s, nil
+	})
+
+	tests := []struct {
+		name     string
+		node     *File
+		writeVal []byte
+		readVal  []byte
+		writeErr error
+		value    func() interface{}
+		expected interface{}
+	}{
+		{"int32", NewAtomicInt32File(&testInt32), []byte("-5\n"), []byte("-5"), nil, func() interface{} { return testInt32.Load() }, int32(-5)},
+		{"int32 overflow", NewAtomicInt32File(&testInt32), []byte("3000000000"), []byte("-5"), fuse.ERANGE, func() interface{} { return testInt32.Load() }, int32(-5)},
+		{"int64", NewAtomicInt64File(&testInt64), []byte("3000000000"), []byte("3000000000"), nil, func() interface{} { return testInt64.Load() }, int64(3000000000)},
+		{"uint64", NewAtomicUint64File(&testUint64), []byte("18446744073709551615"), []byte("18446744073709551615"), nil, func() interface{} { return testUint64.Load() }, uint64(18446744073709551615)},
+		{"uint64 negative", NewAtomicUint64File(&testUint64), []byte("-1"), []byte("18446744073709551615"), fuse.ERANGE, func() interface{} { return testUint64.Load() }, uint64(18446744073709551615)},
+		{"bool", NewAtomicBoolFile(&testBool), []byte("1"), []byte("1"), nil, func() interface{} { return testBool.Load() }, true},
+		{"value", valueFile, []byte("hello\n"), []byte("hello"), nil, func() interface{} { return testValue.Load() }, "hello"},
+	}
+
+	for _, test := range tests {
+		name := "atomic"
+		if err := rootdir.AddNode(name, test.node); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		t.Run(test.name, func(t *testing.T) {
+			file, err := os.OpenFile(path.Join(mountpoint, name), os.O_RDWR, 0666)
+			if err != nil {
+				t.Fatalf("failed to open node: %v", err)
+			}
+			defer file.Close()
+
+			_, err = file.Write(test.writeVal)
+			if !checkError(err, test.writeErr) {
+				t.Errorf("incorrect error writing '%s' to node, expected: %v, got: %v", test.writeVal, test.writeErr, err)
+			}
+
+			if test.value() != test.expected {
+				t.Errorf("incorrect value after writing '%s', expected %v, got %v", test.writeVal, test.expected, test.value())
+			}
+
+			file.Seek(0, 0)
+			r, err := ioutil.ReadAll(file)
+			if err != nil {
+				t.Fatalf("couldn't read file: %v", err)
+			}
+
+			if !bytes.Equal(r, test.readVal) {
+				t.Errorf("incorrect value read, expected '%s', got '%s'", test.readVal, r)
+			}
+		})
+
+		rootdir.RemoveNode(name)
+	}
+}
+
+func TestSliceFileAppend(t *testing.T) {
+	testInts := []int{1, 2}
+	name := "slice"
+	if err := rootdir.AddNode(name, NewIntSliceFile(&testInts)); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write([]byte("3\n4\n")); err != nil {
+		t.Fatalf("failed to append to node: %v", err)
+	}
+
+	if !reflect.DeepEqual(testInts, []int{1, 2, 3, 4}) {
+		t.Errorf("incorrect value after appending, expected [1 2 3 4], got %v", testInts)
+	}
+
+	_, err = file.Write([]byte("5\nsix\n"))
+	if !checkError(err, fuse.ERANGE) {
+		t.Errorf("incorrect error appending invalid line, expected %v, got %v", fuse.ERANGE, err)
+	}
+
+	if !reflect.DeepEqual(testInts, []int{1, 2, 3, 4}) {
+		t.Errorf("slice changed by invalid append, expected [1 2 3 4], got %v", testInts)
+	}
+}
+
+func TestSetFile(t *testing.T) {
+	testSet := make(map[string]struct{})
+	name := "set"
+	if err := rootdir.AddNode(name, NewSetFile(testSet)); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	tests := []struct {
+		name     string
+		flags    int
+		writeVal []byte
+		writeErr error
+		readVal  []byte
+	}{
+		{"replace", os.O_TRUNC, []byte("b\na\n"), nil, []byte("a\nb\n")},
+		{"add", os.O_TRUNC, []byte("+c\n"), nil, []byte("a\nb\nc\n")},
+		{"append add", os.O_APPEND, []byte("+d\n"), nil, []byte("a\nb\nc\nd\n")},
+		{"append remove", os.O_APPEND, []byte("-a\n-b\n"), nil, []byte("c\nd\n")},
+		{"empty edit", os.O_TRUNC, []byte("+\n"), fuse.ERANGE, []byte("c\nd\n")},
+		{"replace and add", os.O_TRUNC, []byte("x\n+y\n-x\n"), nil, []byte("y\n")},
+		{"append member", os.O_APPEND, []byte("z\n"), nil, []byte("y\nz\n")},
+		{"append empty", os.O_APPEND, []byte("\n"), nil, []byte("y\nz\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.OpenFile(path, os.O_WRONLY|tt.flags, 0666)
+			if err != nil {
+				t.Fatalf("failed to open node: %v", err)
+			}
+
+			_, err = file.Write(tt.writeVal)
+			if !checkError(err, tt.writeErr) {
+				t.Errorf("incorrect error writing '%s', expected: %v, got: %v", tt.writeVal, tt.writeErr, err)
+			}
+			file.Close()
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read node: %v", err)
+			}
+
+			if !bytes.Equal(data, tt.readVal) {
+				t.Errorf("incorrect value read, expected '%s', got '%s'", tt.readVal, data)
+			}
+		})
+	}
+
+	t.Run("append with edit-like members", func(t *testing.T) {
+		testSet["-x"] = struct{}{}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+
+		if _, err := file.Write([]byte("+b\n")); err != nil {
+			t.Errorf("failed to write node: %v", err)
+		}
+		file.Close()
+
+		for _, m := range []string{"-x", "b", "y", "z"} {
+			if _, ok := testSet[m]; !ok {
+				t.Errorf("member '%v' missing after appending, got %v", m, testSet)
+			}
+		}
+	})
+
+	t.Run("concurrent appends", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+				if err != nil {
+					t.Errorf("failed to open node: %v", err)
+					return
+				}
+				defer file.Close()
+
+				if _, err := file.Write([]byte(fmt.Sprintf("+%v\n", i))); err != nil {
+					t.Errorf("failed to write node: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if len(testSet) != 24 {
+			t.Errorf("incorrect number of members after concurrent appends, expected 24, got %v", len(testSet))
+		}
+	})
+}
+
+func TestExpressions(t *testing.T) {
+	var (
+		testInt   int
+		testInt8  int8
+		testUint  uint
+		testFloat float64
+		testSize  int64
+		testBool  bool
+
+		testAtomicInt  atomic.Int64
+		testAtomicBool atomic.Bool
+	)
+
+	tests := []struct {
+		node     *File
+		writeVal string
+		writeErr error
+		readVal  string
+	}{
+		{NewIntFile(&testInt), "+=5", nil, "5"},
+		{NewIntFile(&testInt), "-= 7", nil, "-2"},
+		{NewIntFile(&testInt), "*=-3", nil, "6"},
+		{NewIntFile(&testInt), "max=4", nil, "6"},
+		{NewIntFile(&testInt), "max=10", nil, "10"},
+		{NewIntFile(&testInt), "min=3", nil, "3"},
+		{NewIntFile(&testInt), "+=x", fuse.ERANGE, "3"},
+		{NewIntFile(&testInt), "5+=1", fuse.ERANGE, "3"},
+		{NewInt8File(&testInt8), "+=127", nil, "127"},
+		{NewInt8File(&testInt8), "+=1", fuse.ERANGE, "127"},
+		{NewInt8File(&testInt8), "*=2", fuse.ERANGE, "127"},
+		{NewUintFile(&testUint), "-=1", fuse.ERANGE, "0"},
+		{NewFloat64File(&testFloat), "+=1.5", nil, "1.5"},
+		{NewFloat64File(&testFloat), "*=1e308", nil, "1.5e+308"},
+		{NewFloat64File(&testFloat), "*=2", fuse.ERANGE, "1.5e+308"},
+		{NewByteSizeFile(&testSize, BinaryBytes), "+=1MiB", nil, "1MiB"},
+		{NewByteSizeFile(&testSize, BinaryBytes), "+=512KiB", nil, "1.5MiB"},
+		{NewBoolFile(&testBool), "toggle", nil, "1"},
+		{NewBoolFile(&testBool), "toggle\n", nil, "0"},
+		{NewAtomicInt64File(&testAtomicInt), "+=5", nil, "5"},
+		{NewAtomicInt64File(&testAtomicInt), "-=7", nil, "-2"},
+		{NewAtomicInt64File(&testAtomicInt), "*=x", fuse.ERANGE, "-2"},
+		{NewAtomicBoolFile(&testAtomicBool), "toggle", nil, "1"},
+	}
+
+	name := "expression"
+	path := path.Join(mountpoint, name)
+	defer rootdir.RemoveNode(name)
+	for _, tt := range tests {
+		t.Run(tt.writeVal, func(t *testing.T) {
+			if err := rootdir.AddNode(name, tt.node); err != nil {
+				t.Fatalf("failed to add node to dir: %v", err)
+			}
+
+			err := ioutil.WriteFile(path, []byte(tt.writeVal), 0666)
+			if !checkError(err, tt.writeErr) {
+				t.Errorf("incorrect error writing '%v', expected: %v, got: %v", tt.writeVal, tt.writeErr, err)
+			}
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read node: %v", err)
+			}
+
+			if string(data) != tt.readVal {
+				t.Errorf("incorrect value after writing '%v', expected '%v', got '%s'", tt.writeVal, tt.readVal, data)
+			}
+		})
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		testInt = 0
+		if err := rootdir.AddNode(name, NewIntFile(&testInt)); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := ioutil.WriteFile(path, []byte("+=1"), 0666); err != nil {
+					t.Errorf("failed to write node: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if testInt != 20 {
+			t.Errorf("incorrect value after concurrent increments, expected 20, got %v", testInt)
+		}
+	})
+
+	t.Run("concurrent atomic", func(t *testing.T) {
+		testAtomicInt.Store(0)
+		if err := rootdir.AddNode(name, NewAtomicInt64File(&testAtomicInt)); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		// Increments appended through the filesystem race with those from go
+		// code.
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+				if err != nil {
+					t.Errorf("failed to open node: %v", err)
+					return
+				}
+				defer file.Close()
+
+				if _, err := file.Write([]byte("+=1\n")); err != nil {
+					t.Errorf("failed to write node: %v", err)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				testAtomicInt.Add(1)
+			}()
+		}
+		wg.Wait()
+
+		if v := testAtomicInt.Load(); v != 40 {
+			t.Errorf("incorrect value after concurrent increments, expected 40, got %v", v)
+		}
+	})
+
+	t.Run("append", func(t *testing.T) {
+		testInt, testFloat, testBool = 3, 1.005, false
+		appends := []struct {
+			node    *File
+			data    string
+			readVal string
+		}{
+			{NewIntFile(&testInt), "+=1\n", "4"},
+			{NewFloat64FileFormat(&testFloat, 'f', 2), "+=1\n", "2.00"},
+			{NewBoolFile(&testBool), "toggle\n", "1"},
+			{NewAtomicBoolFile(&testAtomicBool), "toggle\n", "0"},
+		}
+
+		for _, tt := range appends {
+			if err := rootdir.AddNode(name, tt.node); err != nil {
+				t.Fatalf("failed to add node to dir: %v", err)
+			}
+
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+			if err != nil {
+				t.Fatalf("failed to open node: %v", err)
+			}
+
+			if _, err := file.Write([]byte(tt.data)); err != nil {
+				t.Errorf("failed to append %q to node: %v", tt.data, err)
+			}
+			file.Close()
+
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read node: %v", err)
+			}
+
+			if string(data) != tt.readVal {
+				t.Errorf("incorrect value after appending %q, expected '%v', got '%s'", tt.data, tt.readVal, data)
+			}
+		}
+
+		if testFloat != 2.005 {
+			t.Errorf("incorrect float after appending expression, expected 2.005, got %v", testFloat)
+		}
+	})
+}
+
+func TestFuncFile(t *testing.T) {
+	var (
+		calls   int32
+		written []byte
+	)
+
+	// Each call returns a different value, of N+1 copies of the digit N, so
+	// that data from different calls being mixed is detected.
+	read := func(ctx context.Context) ([]byte, error) {
+		n := atomic.AddInt32(&calls, 1) % 10
+		return bytes.Repeat([]byte{byte('0' + n)}, int(n)+1), nil
+	}
+	write := func(ctx context.Context, data []byte) error {
+		if bytes.Equal(data, []byte("bad")) {
+			return fmt.Errorf("bad value")
+		}
+		written = data
+		return nil
+	}
+
+	name := "func"
+	path := path.Join(mountpoint, name)
+	defer rootdir.RemoveNode(name)
+
+	t.Run("consistent reads", func(t *testing.T) {
+		f := NewReadOnlyFuncFile(read)
+		if err := rootdir.AddNode(name, f); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		var attr fuse.Attr
+		if err := f.Attr(context.Background(), &attr); err != nil {
+			t.Fatalf("failed to get attributes: %v", err)
+		}
+
+		if attr.Valid != 0 {
+			t.Errorf("attributes of func file cached for %v", attr.Valid)
+		}
+
+		atomic.StoreInt32(&calls, 0)
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		// Read in small chunks, with the file examined in between.
+		var data []byte
+		buf := make([]byte, 2)
+		for {
+			if _, err := os.Stat(path); err != nil {
+				t.Fatalf("failed to stat node: %v", err)
+			}
+
+			n, err := file.Read(buf)
+			data = append(data, buf[:n]...)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("failed to read node: %v", err)
+			}
+		}
+
+		if len(data) == 0 || !bytes.Equal(data, bytes.Repeat(data[:1], int(data[0]-'0')+1)) {
+			t.Errorf("inconsistent data read: '%s'", data)
+		}
+
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("incorrect number of calls to open and read, expected 1, got %v", n)
+		}
+	})
+
+	t.Run("failed open", func(t *testing.T) {
+		fail := true
+		f := NewFuncFile(func(ctx context.Context) ([]byte, error) {
+			if fail {
+				return nil, fuse.Errno(syscall.EBUSY)
+			}
+			return []byte("value"), nil
+		}, write)
+		if err := rootdir.AddNode(name, f); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		_, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if !checkError(err, fuse.Errno(syscall.EBUSY)) {
+			t.Fatalf("incorrect error opening node, expected %v, got %v", fuse.Errno(syscall.EBUSY), err)
+		}
+
+		// The truncation isn't deferred to the handle whose open failed.
+		fail = false
+		written = nil
+		if err := os.Truncate(path, 0); err != nil {
+			t.Fatalf("failed to truncate node: %v", err)
+		}
+
+		if written == nil {
+			t.Errorf("truncation not passed to write")
+		} else if len(written) != 0 {
+			t.Errorf("incorrect data passed to write after truncation, expected '', got '%s'", written)
+		}
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		f := NewReadOnlyFuncFile(func(ctx context.Context) ([]byte, error) {
+			return []byte("computed"), nil
+		})
+		if err := rootdir.AddNode(name, f); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read node: %v", err)
+		}
+
+		if !bytes.Equal(data, []byte("computed")) {
+			t.Errorf("incorrect value read, expected 'computed', got '%s'", data)
+		}
+
+		if f.Mode != 0444 {
+			t.Errorf("incorrect mode for read-only func file, expected 0444, got %v", f.Mode)
+		}
+
+		resp := &fuse.WriteResponse{}
+		err = f.Write(context.Background(), &fuse.WriteRequest{Data: []byte("1")}, resp)
+		if !checkError(err, fuse.EPERM) {
+			t.Errorf("incorrect error writing read-only func file, expected %v, got %v", fuse.EPERM, err)
+		}
+	})
+
+	t.Run("write", func(t *testing.T) {
+		if err := rootdir.AddNode(name, NewFuncFile(read, write)); err != nil {
+			t.Fatalf("failed to add node to dir: %v", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte("value\n"), 0666); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		if !bytes.Equal(written, []byte("value\n")) {
+			t.Errorf("incorrect data passed to write, expected 'value\\n', got '%s'", written)
+		}
+
+		err := ioutil.WriteFile(path, []byte("bad"), 0666)
+		if !checkError(err, fuse.ERANGE) {
+			t.Errorf("incorrect error from failed write, expected %v, got %v", fuse.ERANGE, err)
+		}
+	})
+}
+
+func TestSnapshotFile(t *testing.T) {
+	testString := "first value"
+	f := NewStringFile(&testString)
+	f.Snapshot = true
+
+	name := "snapshot"
+	if err := rootdir.AddNode(name, f); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	defer file.Close()
+
+	// Change the value between reads of the open file.
+	buf := make([]byte, 6)
+	if _, err := file.Read(buf); err != nil {
+		t.Fatalf("failed to read node: %v", err)
+	}
+
+	f.Lock.Lock()
+	testString = "a much longer second value"
+	f.Lock.Unlock()
+	f.Touch()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatalf("failed to read node: %v", err)
+	}
+
+	if expected := "first value"; string(buf)+string(data) != expected {
+		t.Errorf("incorrect value read, expected '%v', got '%s%s'", expected, buf, data)
+	}
+
+	// A new open sees the new value.
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read node: %v", err)
+	}
+
+	if expected := "a much longer second value"; string(data) != expected {
+		t.Errorf("incorrect value read, expected '%v', got '%s'", expected, data)
+	}
+
+	// Writes through the open file are seen by its reads.
+	if _, err := file.WriteAt([]byte("third"), 0); err != nil {
+		t.Fatalf("failed to write node: %v", err)
+	}
+
+	buf = make([]byte, 64)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		t.Fatalf("failed to read node: %v", err)
+	}
+
+	if expected := "third"; string(buf[:n]) != expected {
+		t.Errorf("incorrect value read after write, expected '%v', got '%s'", expected, buf[:n])
+	}
+
+	// The size of the file seen through an open file is that of its value.
+	second, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	defer second.Close()
+
+	if _, err := second.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("failed to read node: %v", err)
+	}
+
+	f.Lock.Lock()
+	testString = "a value longer than the third"
+	f.Lock.Unlock()
+	f.Touch()
+
+	size, err := second.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("failed to seek node: %v", err)
+	}
+
+	if size != int64(len("third")) {
+		t.Errorf("incorrect size seen through open file, expected %v, got %v", len("third"), size)
+	}
+}
+
+// textTestSet is a TextValue which isn't a pointer.
+type textTestSet map[string]bool
+
+func (s textTestSet) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprint(len(s))), nil
+}
+
+func (s textTestSet) UnmarshalText(data []byte) error {
+	s[string(data)] = true
+	return nil
+}
+
+func TestFileAttr(t *testing.T) {
+	testInt := 1
+	name := "attr"
+	if err := rootdir.AddNode(name, NewIntFile(&testInt)); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat node: %v", err)
+	}
+
+	// Stat the open file, as the attributes are then requested with Getattr
+	// rather than a lookup.
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write([]byte("123")); err != nil {
+		t.Fatalf("failed to write node: %v", err)
+	}
+
+	after, err := file.Stat()
+	if err != nil {
+		t.Fatalf("failed to stat node: %v", err)
+	}
+
+	if after.Size() != 3 {
+		t.Errorf("incorrect size after write, expected 3, got %v", after.Size())
+	}
+
+	if after.ModTime().IsZero() || after.ModTime().Unix() == 0 {
+		t.Errorf("modification time not set, got %v", after.ModTime())
+	}
+
+	st := after.Sys().(*syscall.Stat_t)
+	if st.Nlink != 1 {
+		t.Errorf("incorrect link count after write, expected 1, got %v", st.Nlink)
+	}
+
+	if ino := before.Sys().(*syscall.Stat_t).Ino; st.Ino == 0 || st.Ino != ino {
+		t.Errorf("inode changed after write, expected %v, got %v", ino, st.Ino)
+	}
+}
+
+func TestTextFileNonPointer(t *testing.T) {
+	testSet := textTestSet{}
+	name := "text"
+	if err := rootdir.AddNode(name, NewTextFile(testSet)); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0666)
+	if err == nil {
+		_, err = file.Write([]byte("a"))
+		file.Close()
+	}
+
+	if err == nil {
+		t.Errorf("expected error writing to non-pointer text file")
+	}
+
+	if len(testSet) != 0 {
+		t.Errorf("value changed by write to non-pointer text file: %v", testSet)
+	}
+}
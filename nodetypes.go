@@ -2,7 +2,9 @@ package fusebox
 
 import (
 	"context"
+	"encoding"
 	"net/url"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -10,39 +12,78 @@ import (
 	"bazil.org/fuse"
 )
 
-type boolElement struct {
-	Data *bool
+// valueElement is used to represent any value which can be parsed from and
+// formatted to a string.
+type valueElement[T any] struct {
+	Data   *T
+	parse  func(string) (T, error)
+	format func(T) string
 }
 
-// NewBoolFile returns a File based on a FileElement which reads and writes to
-// the given bool pointer.
-func NewBoolFile(b *bool) *File {
-	return NewFile(&boolElement{Data: b})
+// NewValueFile returns a File which has an element that reads from and writes
+// to the given pointer. Reads display the value using format, and writes are
+// trimmed of whitespace and passed to parse. If parse returns an error, the
+// write fails with fuse.ERANGE, unless the error is a fuse.ErrorNumber in which
+// case it is returned as is.
+func NewValueFile[T any](ptr *T, parse func(string) (T, error), format func(T) string) *File {
+	return NewFile(&valueElement[T]{Data: ptr, parse: parse, format: format})
 }
 
-func (bf *boolElement) ValRead(ctx context.Context) ([]byte, error) {
-	if *bf.Data {
-		return []byte("1"), nil
-	}
-	return []byte("0"), nil
+func (e *valueElement[T]) ValRead(ctx context.Context) ([]byte, error) {
+	return []byte(e.format(*e.Data)), nil
 }
 
-func (bf *boolElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	c := strings.TrimSpace(string(req.Data))
-	if c == "0" {
-		*bf.Data = false
-	} else if c == "1" {
-		*bf.Data = true
-	} else {
-		return fuse.ERANGE
+func (e *valueElement[T]) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	v, err := e.Parse(req.Data)
+	if err != nil {
+		return err
 	}
 
+	e.Assign(v)
 	resp.Size = len(req.Data)
 	return nil
 }
 
-func (*boolElement) Size(context.Context) (uint64, error) {
-	return 1, nil
+func (e *valueElement[T]) Parse(data []byte) (interface{}, error) {
+	v, err := e.parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		if _, ok := err.(fuse.ErrorNumber); ok {
+			return nil, err
+		}
+		return nil, fuse.ERANGE
+	}
+	return v, nil
+}
+
+func (e *valueElement[T]) Assign(v interface{}) {
+	(*e.Data) = v.(T)
+}
+
+func (e *valueElement[T]) Size(context.Context) (uint64, error) {
+	return uint64(len(e.format(*e.Data))), nil
+}
+
+// NewBoolFile returns a File based on a FileElement which reads and writes to
+// the given bool pointer. The value is displayed as 0 or 1, and only these
+// values can be written, along with "toggle", which inverts the value.
+func NewBoolFile(b *bool) *File {
+	return relativeValueFile(b, toggleBool(b, parseBool), formatBool)
+}
+
+func parseBool(s string) (bool, error) {
+	if s == "0" {
+		return false, nil
+	} else if s == "1" {
+		return true, nil
+	}
+	return false, fuse.ERANGE
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
 }
 
 type channelElement struct {
@@ -54,6 +95,7 @@ type channelElement struct {
 func NewChanFile(c chan int) *File {
 	ret := NewFile(&channelElement{c})
 	ret.Mode = 0222
+	ret.Stream = true
 	return ret
 }
 
@@ -75,158 +117,141 @@ func (cf *channelElement) Size(context.Context) (uint64, error) {
 	return 0, nil
 }
 
-// intElement is used to represt and int
-type intElement struct {
-	Data *int
-}
-
 // NewIntFile returns a new file with an Element which reads and updates
 // the given int pointer.
+//
+// As well as plain values, expressions relative to the current value can be
+// written: "+=N", "-=N" and "*=N" add, subtract or multiply the value by N,
+// and "max=N" and "min=N" raise or lower it to N. These are applied while the
+// File's Lock is held, so concurrent writers don't lose updates. Expressions
+// can also be appended, as with `echo +=1 >> file`, as appended data is parsed
+// on its own rather than following the current value. The other integer,
+// float, unit and atomic integer files accept the same expressions.
 func NewIntFile(i *int) *File {
-	return NewFile(&intElement{Data: i})
-}
-
-func (f *intElement) ValRead(ctx context.Context) ([]byte, error) {
-	return []byte(strconv.Itoa(*f.Data)), nil
+	return relativeValueFile(i, withExpressions(i, parseSigned[int](strconv.IntSize)), formatSigned[int])
 }
 
-func (f *intElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	trimmed := strings.TrimSpace(string(req.Data))
-	if len(trimmed) == 0 {
-		trimmed = "0"
-	}
-
-	i, err := strconv.Atoi(trimmed)
-	if err != nil {
-		return fuse.ERANGE
-	}
-
-	(*f.Data) = i
-	resp.Size = len(req.Data)
-	return nil
+// NewInt64File returns a new File which has an element that reads
+// and updates the given int64 pointer appropriately.
+func NewInt64File(i *int64) *File {
+	return relativeValueFile(i, withExpressions(i, parseSigned[int64](64)), formatSigned[int64])
 }
 
-func (f *intElement) Size(context.Context) (uint64, error) {
-	return uint64(len(strconv.Itoa(*f.Data))), nil
+// NewStringFile returns a File which has an element that reads from and
+// writes to the given string pointer.
+func NewStringFile(s *string) *File {
+	return NewValueFile(s, parseString, formatString)
 }
 
-type int64Element struct {
-	Data *int64
+func parseString(s string) (string, error) {
+	return s, nil
 }
 
-// NewInt64File returns a new File which has an element that reads
-// and updates the given int64 pointer appropriately.
-func NewInt64File(i *int64) *File {
-	return NewFile(&int64Element{Data: i})
+func formatString(s string) string {
+	return s
 }
 
-func (f *int64Element) ValRead(ctx context.Context) ([]byte, error) {
-	return []byte(strconv.FormatInt(*f.Data, 10)), nil
+// NewRegexpFile returns a File which has an element that displays the given
+// regexp.Regexp as a string on reads, and attempts to compile and modify it
+// upon writes
+func NewRegexpFile(r *regexp.Regexp) *File {
+	return NewValueFile(r, parseRegexp, formatRegexp)
 }
 
-func (f *int64Element) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	trimmed := strings.TrimSpace(string(req.Data))
-	if len(trimmed) == 0 {
-		trimmed = "0"
-	}
-
-	i, err := strconv.ParseInt(trimmed, 10, 64)
+func parseRegexp(s string) (regexp.Regexp, error) {
+	r, err := regexp.Compile(s)
 	if err != nil {
-		return fuse.ERANGE
+		return regexp.Regexp{}, err
 	}
-
-	(*f.Data) = i
-	resp.Size = len(req.Data)
-	return nil
-}
-
-func (f *int64Element) Size(context.Context) (uint64, error) {
-	return uint64(len(strconv.FormatInt(*f.Data, 10))), nil
+	return *r, nil
 }
 
-type stringElement struct {
-	Data *string
+func formatRegexp(r regexp.Regexp) string {
+	return r.String()
 }
 
-// NewStringFile returns a File which has an element that reads from and
-// writes to the given string pointer.
-func NewStringFile(s *string) *File {
-	return NewFile(&stringElement{Data: s})
+// NewURLFile returns a File which has an element that reads from and
+// updats the given url.URL pointer appropriately.
+func NewURLFile(u *url.URL) *File {
+	return NewValueFile(u, parseURL, formatURL)
 }
 
-func (sf *stringElement) ValRead(ctx context.Context) ([]byte, error) {
-	return []byte(*sf.Data), nil
+func parseURL(s string) (url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return url.URL{}, err
+	}
+	return *u, nil
 }
 
-func (sf *stringElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	(*sf.Data) = strings.TrimSpace(string(req.Data))
-	resp.Size = len(req.Data)
-	return nil
+func formatURL(u url.URL) string {
+	return u.String()
 }
 
-func (sf *stringElement) Size(context.Context) (uint64, error) {
-	return uint64(len(*sf.Data)), nil
+// TextValue is implemented by types which can be converted to and from text,
+// such as net.IP, big.Int and time.Time.
+type TextValue interface {
+	encoding.TextMarshaler
+	encoding.TextUnmarshaler
 }
 
-type regexpElement struct {
-	Data *regexp.Regexp
+// textElement is used to represent any TextValue
+type textElement struct {
+	Data TextValue
 }
 
-// NewRegexpFile returns a File which has an element that displays the given
-// regexp.Regexp as a string on reads, and attempts to compile and modify it
-// upon writes
-func NewRegexpFile(r *regexp.Regexp) *File {
-	return NewFile(&regexpElement{Data: r})
+// NewTextFile returns a File which has an element that reads from and writes
+// to the given value using its MarshalText and UnmarshalText methods. The new
+// value is unmarshalled into a copy before being assigned, so that v is left
+// unchanged if UnmarshalText or a Validator fails. As only values pointed to
+// can be copied, the File is read-only if v isn't a pointer.
+func NewTextFile(v TextValue) *File {
+	ret := NewFile(&textElement{Data: v})
+	if reflect.ValueOf(v).Kind() != reflect.Ptr {
+		ret.Mode = 0444
+	}
+	return ret
 }
 
-func (rf *regexpElement) ValRead(ctx context.Context) ([]byte, error) {
-	return []byte((*rf.Data).String()), nil
+func (f *textElement) ValRead(ctx context.Context) ([]byte, error) {
+	return f.Data.MarshalText()
 }
 
-func (rf *regexpElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	c := strings.TrimSpace(string(req.Data))
-	r, err := regexp.Compile(c)
+func (f *textElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	v, err := f.Parse(req.Data)
 	if err != nil {
-		return fuse.ERANGE
+		return err
 	}
 
-	*rf.Data = *r
+	f.Assign(v)
 	resp.Size = len(req.Data)
 	return nil
 }
 
-func (rf *regexpElement) Size(context.Context) (uint64, error) {
-	return uint64(len((*rf.Data).String())), nil
-}
-
-// urlElement is used to represent a url.URL
-type urlElement struct {
-	Data *url.URL
-}
-
-// NewURLFile returns a File which has an element that reads from and
-// updats the given url.URL pointer appropriately.
-func NewURLFile(u *url.URL) *File {
-	return NewFile(&urlElement{Data: u})
-}
+func (f *textElement) Parse(data []byte) (interface{}, error) {
+	trimmed := []byte(strings.TrimSpace(string(data)))
+	v := reflect.ValueOf(f.Data)
+	if v.Kind() != reflect.Ptr {
+		return nil, fuse.EPERM
+	}
 
-func (f *urlElement) ValRead(ctx context.Context) ([]byte, error) {
-	return []byte(f.Data.String()), nil
+	n := reflect.New(v.Type().Elem())
+	if err := n.Interface().(encoding.TextUnmarshaler).UnmarshalText(trimmed); err != nil {
+		return nil, fuse.ERANGE
+	}
+	return n.Interface(), nil
 }
 
-func (f *urlElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
-	u, err := url.Parse(strings.TrimSpace(string(req.Data)))
-	if err != nil {
-		return fuse.ERANGE
+func (f *textElement) Assign(v interface{}) {
+	d := reflect.ValueOf(f.Data)
+	if d.Kind() == reflect.Ptr {
+		d.Elem().Set(reflect.ValueOf(v).Elem())
 	}
-
-	(*f.Data) = *u
-	resp.Size = len(req.Data)
-	return nil
 }
 
-func (f *urlElement) Size(context.Context) (uint64, error) {
-	return uint64(len(f.Data.String())), nil
+func (f *textElement) Size(context.Context) (uint64, error) {
+	data, err := f.Data.MarshalText()
+	return uint64(len(data)), err
 }
 
 type bytePipeElement struct {
@@ -238,6 +263,7 @@ type bytePipeElement struct {
 func NewBytePipeFile(c chan []byte) *File {
 	ret := NewFile(&bytePipeElement{Chan: c})
 	ret.OpenFlags = fuse.OpenDirectIO
+	ret.Stream = true
 	return ret
 }
 
@@ -0,0 +1,181 @@
+package fusebox
+
+import (
+	"strconv"
+	"strings"
+)
+
+// signed, unsigned and float are the numeric types supported by the numeric
+// files.
+type signed interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+type unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+type float interface {
+	~float32 | ~float64
+}
+
+// integer and number are the unions of the above.
+type integer interface {
+	signed | unsigned
+}
+
+type number interface {
+	signed | unsigned | float
+}
+
+// trimNumber trims whitespace from data written to a numeric file, treating
+// an empty write as zero.
+func trimNumber(data []byte) string {
+	trimmed := strings.TrimSpace(string(data))
+	if len(trimmed) == 0 {
+		return "0"
+	}
+	return trimmed
+}
+
+// parseSigned returns a function which parses a signed integer which fits in
+// the given number of bits, treating an empty string as zero.
+func parseSigned[T signed](bits int) func(string) (T, error) {
+	return func(s string) (T, error) {
+		if len(s) == 0 {
+			return 0, nil
+		}
+
+		i, err := strconv.ParseInt(s, 10, bits)
+		return T(i), err
+	}
+}
+
+func formatSigned[T signed](i T) string {
+	return strconv.FormatInt(int64(i), 10)
+}
+
+// parseUnsigned returns a function which parses an unsigned integer which fits
+// in the given number of bits, treating an empty string as zero.
+func parseUnsigned[T unsigned](bits int) func(string) (T, error) {
+	return func(s string) (T, error) {
+		if len(s) == 0 {
+			return 0, nil
+		}
+
+		i, err := strconv.ParseUint(s, 10, bits)
+		return T(i), err
+	}
+}
+
+func formatUnsigned[T unsigned](i T) string {
+	return strconv.FormatUint(uint64(i), 10)
+}
+
+// parseFloat returns a function which parses a float of the given bit size,
+// treating an empty string as zero.
+func parseFloat[T float](bits int) func(string) (T, error) {
+	return func(s string) (T, error) {
+		if len(s) == 0 {
+			return 0, nil
+		}
+
+		f, err := strconv.ParseFloat(s, bits)
+		return T(f), err
+	}
+}
+
+// formatFloat returns a function which formats a float of the given bit size
+// using strconv.FormatFloat with the given format and precision.
+func formatFloat[T float](fmt byte, prec, bits int) func(T) string {
+	return func(f T) string {
+		return strconv.FormatFloat(float64(f), fmt, prec, bits)
+	}
+}
+
+// NewInt8File returns a File which has an element that reads and updates the
+// given int8 pointer. Writing a value which doesn't fit in an int8 fails with
+// fuse.ERANGE.
+func NewInt8File(i *int8) *File {
+	return relativeValueFile(i, withExpressions(i, parseSigned[int8](8)), formatSigned[int8])
+}
+
+// NewInt16File returns a File which has an element that reads and updates the
+// given int16 pointer. Writing a value which doesn't fit in an int16 fails with
+// fuse.ERANGE.
+func NewInt16File(i *int16) *File {
+	return relativeValueFile(i, withExpressions(i, parseSigned[int16](16)), formatSigned[int16])
+}
+
+// NewInt32File returns a File which has an element that reads and updates the
+// given int32 pointer. Writing a value which doesn't fit in an int32 fails with
+// fuse.ERANGE.
+func NewInt32File(i *int32) *File {
+	return relativeValueFile(i, withExpressions(i, parseSigned[int32](32)), formatSigned[int32])
+}
+
+// NewUintFile returns a File which has an element that reads and updates the
+// given uint pointer. Writing a negative value, or one which doesn't fit in a
+// uint, fails with fuse.ERANGE.
+func NewUintFile(i *uint) *File {
+	return relativeValueFile(i, withExpressions(i, parseUnsigned[uint](strconv.IntSize)), formatUnsigned[uint])
+}
+
+// NewUint8File returns a File which has an element that reads and updates the
+// given uint8 pointer. Writing a negative value, or one which doesn't fit in a
+// uint8, fails with fuse.ERANGE.
+func NewUint8File(i *uint8) *File {
+	return relativeValueFile(i, withExpressions(i, parseUnsigned[uint8](8)), formatUnsigned[uint8])
+}
+
+// NewUint16File returns a File which has an element that reads and updates the
+// given uint16 pointer. Writing a negative value, or one which doesn't fit in a
+// uint16, fails with fuse.ERANGE.
+func NewUint16File(i *uint16) *File {
+	return relativeValueFile(i, withExpressions(i, parseUnsigned[uint16](16)), formatUnsigned[uint16])
+}
+
+// NewUint32File returns a File which has an element that reads and updates the
+// given uint32 pointer. Writing a negative value, or one which doesn't fit in a
+// uint32, fails with fuse.ERANGE.
+func NewUint32File(i *uint32) *File {
+	return relativeValueFile(i, withExpressions(i, parseUnsigned[uint32](32)), formatUnsigned[uint32])
+}
+
+// NewUint64File returns a File which has an element that reads and updates the
+// given uint64 pointer. Writing a negative value fails with fuse.ERANGE.
+func NewUint64File(i *uint64) *File {
+	return relativeValueFile(i, withExpressions(i, parseUnsigned[uint64](64)), formatUnsigned[uint64])
+}
+
+// NewFloat32File returns a File which has an element that reads and updates
+// the given float32 pointer. Values are displayed in the shortest format which
+// represents them exactly, as with NewFloat32FileFormat(f, 'g', -1).
+func NewFloat32File(f *float32) *File {
+	return NewFloat32FileFormat(f, 'g', -1)
+}
+
+// NewFloat32FileFormat returns a File which has an element that reads and
+// updates the given float32 pointer. Values are displayed using
+// strconv.FormatFloat with the given format, such as 'f' or 'g', and
+// precision. Writing a value which doesn't fit in a float32 fails with
+// fuse.ERANGE.
+func NewFloat32FileFormat(f *float32, fmt byte, prec int) *File {
+	return relativeValueFile(f, withExpressions(f, parseFloat[float32](32)), formatFloat[float32](fmt, prec, 32))
+}
+
+// NewFloat64File returns a File which has an element that reads and updates
+// the given float64 pointer. Values are displayed in the shortest format which
+// represents them exactly, as with NewFloat64FileFormat(f, 'g', -1).
+func NewFloat64File(f *float64) *File {
+	return NewFloat64FileFormat(f, 'g', -1)
+}
+
+// NewFloat64FileFormat returns a File which has an element that reads and
+// updates the given float64 pointer. Values are displayed using
+// strconv.FormatFloat with the given format, such as 'f' or 'g', and
+// precision. Writing a value which doesn't fit in a float64 fails with
+// fuse.ERANGE.
+func NewFloat64FileFormat(f *float64, fmt byte, prec int) *File {
+	return relativeValueFile(f, withExpressions(f, parseFloat[float64](64)), formatFloat[float64](fmt, prec, 64))
+}
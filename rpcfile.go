@@ -0,0 +1,134 @@
+package fusebox
+
+import (
+	"context"
+	"sync"
+
+	"bazil.org/fuse"
+)
+
+// rpcElement is used to represent an endpoint which answers each request
+// written to it with a response which is read back through the same open file.
+type rpcElement struct {
+	handler func(context.Context, []byte) ([]byte, error)
+}
+
+// rpcCall is the State of each Handle of an rpcElement. It holds the request
+// being written, or the response to the last one along with the offset at
+// which the request ended.
+type rpcCall struct {
+	mu      sync.Mutex
+	req     []byte
+	pending bool
+	resp    []byte
+	base    int64
+}
+
+var _ handleServer = (*rpcElement)(nil)
+
+// NewRPCFile returns a File which answers requests by calling handler, such as
+// for looking up a host in a cache. Data written to an open file is collected
+// as a request, which is passed to handler when the open file is next read
+// from or closed, and the response it returns is read back through the same
+// open file:
+//
+//	exec 3<>lookup
+//	echo example.com >&3
+//	cat <&3
+//
+// Each open file has its own request and response, and handler is called
+// without holding the File's Lock, so concurrent callers using their own open
+// files neither see each other's responses nor wait for each other. A request
+// may be written in any number of writes, so requests larger than the
+// kernel's maximum write size are passed to handler whole. Writing after the
+// response has been read starts a new request.
+//
+// Reads following a request start at the beginning of its response, as do
+// reads at offset zero. Until a request has been written, reads return no
+// data. The written data is passed as is, without trimming whitespace. If
+// handler returns an error, the read or close which called it fails with it,
+// so a fuse.Errno such as fuse.Errno(syscall.ENOENT) can be used to set the
+// errno seen by the caller, while other errors are reported as EIO.
+func NewRPCFile(handler func(ctx context.Context, req []byte) ([]byte, error)) *File {
+	ret := NewFile(&rpcElement{handler: handler})
+	ret.Stream = true
+	ret.OpenFlags = fuse.OpenDirectIO
+	return ret
+}
+
+func (e *rpcElement) OpenHandle(ctx context.Context, h *Handle) error {
+	h.State = &rpcCall{}
+	return nil
+}
+
+func (e *rpcElement) ReleaseHandle(ctx context.Context, h *Handle) error {
+	return nil
+}
+
+// call passes any pending request to the handler, and stores its response.
+// The caller must hold c.mu.
+func (e *rpcElement) call(ctx context.Context, c *rpcCall) error {
+	if !c.pending {
+		return nil
+	}
+
+	req := c.req
+	c.req, c.pending, c.resp = nil, false, nil
+	resp, err := e.handler(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	c.resp = resp
+	return nil
+}
+
+func (e *rpcElement) readHandle(ctx context.Context, h *Handle, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	c := h.State.(*rpcCall)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := e.call(ctx, c); err != nil {
+		return err
+	}
+
+	off := req.Offset
+	if off >= c.base {
+		off -= c.base
+	}
+	resp.Data = readAt(c.resp, off, req.Size)
+	return nil
+}
+
+func (e *rpcElement) writeHandle(ctx context.Context, h *Handle, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	c := h.State.(*rpcCall)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.req = append(c.req, req.Data...)
+	c.pending = true
+	c.base = req.Offset + int64(len(req.Data))
+	resp.Size = len(req.Data)
+	return nil
+}
+
+func (e *rpcElement) flushHandle(ctx context.Context, h *Handle) error {
+	c := h.State.(*rpcCall)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return e.call(ctx, c)
+}
+
+// ValRead returns no data, as responses are only read through the Handle
+// which made the request.
+func (e *rpcElement) ValRead(ctx context.Context) ([]byte, error) {
+	return nil, nil
+}
+
+// ValWrite returns fuse.EPERM, as requests can only be written through a
+// Handle.
+func (e *rpcElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	return fuse.EPERM
+}
+
+func (e *rpcElement) Size(ctx context.Context) (uint64, error) {
+	return 0, nil
+}
@@ -0,0 +1,182 @@
+package fusebox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+func TestRPCFile(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req []byte) ([]byte, error) {
+		switch {
+		case string(req) == "fail":
+			return nil, fuse.Errno(syscall.EINVAL)
+		case string(req) == "block":
+			<-release
+		case len(req) > 1000:
+			return []byte(fmt.Sprint(len(req))), nil
+		}
+		return bytes.ToUpper(req), nil
+	}
+
+	name := "rpc"
+	if err := rootdir.AddNode(name, NewRPCFile(handler)); err != nil {
+		t.Fatalf("failed to add node to dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	path := path.Join(mountpoint, name)
+
+	call := func(file *os.File, req string) (string, error) {
+		if _, err := file.Write([]byte(req)); err != nil {
+			return "", err
+		}
+
+		data, err := ioutil.ReadAll(file)
+		return string(data), err
+	}
+
+	t.Run("request", func(t *testing.T) {
+		file, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		for _, req := range []string{"first", "second request"} {
+			resp, err := call(file, req)
+			if err != nil {
+				t.Fatalf("failed to call node: %v", err)
+			}
+
+			if expected := string(bytes.ToUpper([]byte(req))); resp != expected {
+				t.Errorf("incorrect response, expected '%v', got '%v'", expected, resp)
+			}
+		}
+
+		// The response can be read again from the start.
+		buf := make([]byte, 64)
+		n, _ := file.ReadAt(buf, 0)
+		if expected := "SECOND REQUEST"; string(buf[:n]) != expected {
+			t.Errorf("incorrect response read at offset 0, expected '%v', got '%s'", expected, buf[:n])
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		file, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := call(file, "ok"); err != nil {
+			t.Fatalf("failed to call node: %v", err)
+		}
+
+		_, err = call(file, "fail")
+		if !checkError(err, fuse.Errno(syscall.EINVAL)) {
+			t.Errorf("incorrect error from failed request, expected %v, got %v", fuse.Errno(syscall.EINVAL), err)
+		}
+
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			t.Fatalf("failed to read node: %v", err)
+		}
+
+		if len(data) != 0 {
+			t.Errorf("response to previous request read after failed request: '%s'", data)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				file, err := os.OpenFile(path, os.O_RDWR, 0666)
+				if err != nil {
+					t.Errorf("failed to open node: %v", err)
+					return
+				}
+				defer file.Close()
+
+				for j := 0; j < 10; j++ {
+					req := fmt.Sprintf("caller %v request %v", i, j)
+					resp, err := call(file, req)
+					if err != nil {
+						t.Errorf("failed to call node: %v", err)
+						return
+					}
+
+					if expected := string(bytes.ToUpper([]byte(req))); resp != expected {
+						t.Errorf("incorrect response, expected '%v', got '%v'", expected, resp)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	t.Run("large request", func(t *testing.T) {
+		file, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		// This is larger than the kernel's maximum write size, so arrives in
+		// several writes.
+		resp, err := call(file, string(bytes.Repeat([]byte("x"), 300000)))
+		if err != nil {
+			t.Fatalf("failed to call node: %v", err)
+		}
+
+		if resp != "300000" {
+			t.Errorf("incorrect response to large request, expected '300000', got '%v'", resp)
+		}
+	})
+
+	t.Run("slow handler", func(t *testing.T) {
+		blocked, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer blocked.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := call(blocked, "block")
+			done <- err
+		}()
+
+		// Other callers aren't held up by the blocked handler.
+		file, err := os.OpenFile(path, os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatalf("failed to open node: %v", err)
+		}
+		defer file.Close()
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("failed to stat node: %v", err)
+		}
+
+		resp, err := call(file, "quick")
+		if err != nil || resp != "QUICK" {
+			t.Errorf("incorrect response while another call was blocked, expected 'QUICK', got '%v', %v", resp, err)
+		}
+
+		close(release)
+		if err := <-done; err != nil {
+			t.Errorf("failed to call node: %v", err)
+		}
+	})
+}
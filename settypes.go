@@ -0,0 +1,129 @@
+package fusebox
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"bazil.org/fuse"
+)
+
+type setElement struct {
+	Data map[string]struct{}
+}
+
+// NewSetFile returns a File which has an element that reads and updates the
+// given set of strings. Reads list the members in sorted order, one per line.
+// Each line written is trimmed of whitespace, and empty lines are ignored. A
+// line of the form "+name" adds name to the set, and "-name" removes it, while
+// any other line is taken as a member. If a write contains members, they
+// replace the set before any additions or removals are applied, otherwise the
+// additions and removals are applied to the current set. An empty write
+// clears the set.
+//
+// Lines appended to the file with O_APPEND are applied to the current set, so
+// that members are added without replacing it. As writes are made under the
+// File's Lock, appending to the file, such as with `echo +name >> file`, adds
+// to the set without losing concurrent updates. Code accessing the set
+// concurrently should also hold the Lock.
+func NewSetFile(s map[string]struct{}) *File {
+	return NewFile(&setElement{Data: s})
+}
+
+func (e *setElement) ValRead(ctx context.Context) ([]byte, error) {
+	return []byte(e.format()), nil
+}
+
+func (e *setElement) ValWrite(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	v, err := e.Parse(req.Data)
+	if err != nil {
+		return err
+	}
+
+	e.Assign(v)
+	resp.Size = len(req.Data)
+	return nil
+}
+
+// appendData converts the appended lines into additions and removals, so that
+// they are applied to the set directly rather than to its listing.
+func (e *setElement) appendData(data []byte) []byte {
+	var ret []byte
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] != '+' && line[0] != '-' {
+			ret = append(ret, '+')
+		}
+		ret = append(append(ret, line...), '\n')
+	}
+	return ret
+}
+
+// Parse returns the set resulting from applying the written data to the
+// current set.
+func (e *setElement) Parse(data []byte) (interface{}, error) {
+	var members, edits []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if line[0] == '+' || line[0] == '-' {
+			if len(line) == 1 {
+				return nil, fuse.ERANGE
+			}
+			edits = append(edits, line)
+			continue
+		}
+		members = append(members, line)
+	}
+
+	ret := make(map[string]struct{})
+	if len(edits) > 0 && len(members) == 0 {
+		for k := range e.Data {
+			ret[k] = struct{}{}
+		}
+	}
+
+	for _, m := range members {
+		ret[m] = struct{}{}
+	}
+
+	for _, edit := range edits {
+		if edit[0] == '+' {
+			ret[edit[1:]] = struct{}{}
+		} else {
+			delete(ret, edit[1:])
+		}
+	}
+	return ret, nil
+}
+
+// Assign replaces the members of the set with those of the given set.
+func (e *setElement) Assign(v interface{}) {
+	for k := range e.Data {
+		delete(e.Data, k)
+	}
+
+	for k := range v.(map[string]struct{}) {
+		e.Data[k] = struct{}{}
+	}
+}
+
+func (e *setElement) Size(context.Context) (uint64, error) {
+	return uint64(len(e.format())), nil
+}
+
+func (e *setElement) format() string {
+	members := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		members = append(members, k)
+	}
+	sort.Strings(members)
+	return formatLines(formatString)(members)
+}
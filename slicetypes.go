@@ -0,0 +1,65 @@
+package fusebox
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NewSliceFile returns a File which has an element that reads from and writes
+// to the given slice, with one element per line. Reads display each element
+// using format, followed by a newline. Writes replace the whole slice, with
+// each line trimmed of whitespace and passed to parse, and empty lines
+// ignored. Writing to a file opened with O_APPEND therefore appends the lines
+// written to the slice. If parse returns an error for any line, the write
+// fails with fuse.ERANGE and the slice is left unchanged.
+func NewSliceFile[T any](s *[]T, parse func(string) (T, error), format func(T) string) *File {
+	return NewValueFile(s, parseLines(parse), formatLines(format))
+}
+
+// parseLines returns a function which parses each non-empty line of a string
+// using parse.
+func parseLines[T any](parse func(string) (T, error)) func(string) ([]T, error) {
+	return func(s string) ([]T, error) {
+		ret := make([]T, 0)
+		for i, line := range strings.Split(s, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+
+			v, err := parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", i+1, err)
+			}
+			ret = append(ret, v)
+		}
+		return ret, nil
+	}
+}
+
+// formatLines returns a function which formats each element of a slice using
+// format, followed by a newline.
+func formatLines[T any](format func(T) string) func([]T) string {
+	return func(s []T) string {
+		var b strings.Builder
+		for _, v := range s {
+			b.WriteString(format(v))
+			b.WriteByte('\n')
+		}
+		return b.String()
+	}
+}
+
+// NewStringSliceFile returns a File which has an element that reads from and
+// writes to the given slice of strings, with one string per line. Strings are
+// trimmed of whitespace, and empty strings are not kept. See NewSliceFile.
+func NewStringSliceFile(s *[]string) *File {
+	return NewSliceFile(s, parseString, formatString)
+}
+
+// NewIntSliceFile returns a File which has an element that reads from and
+// writes to the given slice of ints, with one int per line. See NewSliceFile.
+func NewIntSliceFile(s *[]int) *File {
+	return NewSliceFile(s, parseSigned[int](strconv.IntSize), formatSigned[int])
+}
@@ -0,0 +1,187 @@
+package fusebox
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// structTag holds the options parsed from a `fusebox:"..."` struct field tag.
+type structTag struct {
+	name string
+	ro   bool
+	omit bool
+}
+
+// parseStructTag parses the fusebox tag of the given field. The first
+// comma separated value is used as the name of the node, and defaults to the
+// field name if empty. The remaining values are options, of which "ro" and
+// "omit" are recognised.
+func parseStructTag(f reflect.StructField) structTag {
+	parts := strings.Split(f.Tag.Get("fusebox"), ",")
+	ret := structTag{name: parts[0]}
+	if ret.name == "" {
+		ret.name = f.Name
+	}
+
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "ro":
+			ret.ro = true
+		case "omit":
+			ret.omit = true
+		}
+	}
+
+	return ret
+}
+
+// NewStructDir returns a Dir containing a node for each exported field of the
+// struct pointed to by ptr. Fields with a supported type, or which implement
+// TextValue, are exposed as Files which read and write the field directly, and
+// nested structs are exposed as subdirectories.
+//
+// The name and behaviour of each node can be controlled with a tag of the form
+// `fusebox:"name,ro,omit"`. If the name is empty, the field name is used. The
+// ro option sets the mode of the File (or every File below a nested struct) to
+// 0444, and the omit option skips the field entirely.
+//
+// An error is returned if ptr is not a non-nil pointer to a struct, if a
+// field that isn't omitted has an unsupported type, if two fields have the
+// same name, or if the ro option is given for a write-only type such as chan
+// int.
+func NewStructDir(ptr interface{}) (*Dir, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a non-nil pointer to a struct, got %T", ptr)
+	}
+
+	return newStructDir(v.Elem(), false)
+}
+
+func newStructDir(v reflect.Value, ro bool) (*Dir, error) {
+	nodes := make(map[string]VarNodeable)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := parseStructTag(field)
+		if tag.omit {
+			continue
+		}
+
+		if _, ok := nodes[tag.name]; ok {
+			return nil, fmt.Errorf("field %v: duplicate name %q", field.Name, tag.name)
+		}
+
+		n, err := newStructFieldNode(v.Field(i), ro || tag.ro)
+		if err != nil {
+			return nil, fmt.Errorf("field %v: %v", field.Name, err)
+		}
+
+		nodes[tag.name] = n
+	}
+
+	return NewMapDir(nodes), nil
+}
+
+// newStructFieldNode returns a node exposing the given struct field, which must
+// be addressable. If the field is a non-nil pointer, and the pointer type isn't
+// supported directly, the node exposes the value it points to.
+func newStructFieldNode(v reflect.Value, ro bool) (VarNodeable, error) {
+	var f *File
+	switch p := v.Addr().Interface().(type) {
+	case *bool:
+		f = NewBoolFile(p)
+	case *int:
+		f = NewIntFile(p)
+	case *int8:
+		f = NewInt8File(p)
+	case *int16:
+		f = NewInt16File(p)
+	case *int32:
+		f = NewInt32File(p)
+	case *int64:
+		f = NewInt64File(p)
+	case *uint:
+		f = NewUintFile(p)
+	case *uint8:
+		f = NewUint8File(p)
+	case *uint16:
+		f = NewUint16File(p)
+	case *uint32:
+		f = NewUint32File(p)
+	case *uint64:
+		f = NewUint64File(p)
+	case *float32:
+		f = NewFloat32File(p)
+	case *float64:
+		f = NewFloat64File(p)
+	case *string:
+		f = NewStringFile(p)
+	case *[]string:
+		f = NewStringSliceFile(p)
+	case *[]int:
+		f = NewIntSliceFile(p)
+	case *regexp.Regexp:
+		f = NewRegexpFile(p)
+	case *url.URL:
+		f = NewURLFile(p)
+	case *net.IP:
+		f = NewIPFile(p)
+	case *net.IPNet:
+		f = NewIPNetFile(p)
+	case *[]*net.IPNet:
+		f = NewIPNetListFile(p)
+	case *atomic.Int32:
+		f = NewAtomicInt32File(p)
+	case *atomic.Int64:
+		f = NewAtomicInt64File(p)
+	case *atomic.Uint64:
+		f = NewAtomicUint64File(p)
+	case *atomic.Bool:
+		f = NewAtomicBoolFile(p)
+	case *time.Duration:
+		f = NewDurationFile(p)
+	case *time.Time:
+		f = NewTimeFile(p)
+	case **time.Location:
+		f = NewLocationFile(p)
+	case *chan int:
+		f = NewChanFile(*p)
+	case *chan []byte:
+		f = NewBytePipeFile(*p)
+	default:
+		if tv, ok := p.(TextValue); ok {
+			f = NewTextFile(tv)
+			break
+		}
+		switch v.Kind() {
+		case reflect.Ptr:
+			if v.IsNil() {
+				return nil, fmt.Errorf("nil pointer of type %v", v.Type())
+			}
+			return newStructFieldNode(v.Elem(), ro)
+		case reflect.Struct:
+			return newStructDir(v, ro)
+		}
+		return nil, fmt.Errorf("unsupported type %v", v.Type())
+	}
+
+	if ro {
+		if f.Mode&0444 == 0 {
+			return nil, fmt.Errorf("ro option on write-only type %v", v.Type())
+		}
+		f.Mode = 0444
+	}
+
+	return f, nil
+}
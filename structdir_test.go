@@ -0,0 +1,124 @@
+package fusebox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+func TestStructDir(t *testing.T) {
+	type nested struct {
+		Level int
+	}
+
+	var testStruct struct {
+		Enabled  bool
+		Count    int
+		Name     string `fusebox:"hostname"`
+		Version  string `fusebox:",ro"`
+		Skipped  int    `fusebox:",omit"`
+		Nested   nested `fusebox:"nested"`
+		Pointer  *nested
+		Started  time.Time
+		internal int
+	}
+	testStruct.Version = "1.0"
+	testStruct.Pointer = &nested{}
+
+	d, err := NewStructDir(&testStruct)
+	if err != nil {
+		t.Fatalf("failed to create struct dir: %v", err)
+	}
+
+	name := "struct"
+	if err := rootdir.AddNode(name, d); err != nil {
+		t.Fatalf("failed to add dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	dpath := path.Join(mountpoint, name)
+
+	t.Run("nodes", func(t *testing.T) {
+		checkDirContents(t, dpath, []string{"Enabled", "Count", "hostname", "Version", "nested", "Pointer", "Started"})
+		checkDirContents(t, path.Join(dpath, "nested"), []string{"Level"})
+		if !checkType(path.Join(dpath, "nested"), fuse.DT_Dir) {
+			t.Errorf("nested struct not exposed as dir")
+		}
+	})
+
+	writeTests := []struct {
+		name     string
+		writeVal []byte
+		writeErr error
+		check    func() bool
+	}{
+		{"Enabled", []byte("1"), nil, func() bool { return testStruct.Enabled }},
+		{"Count", []byte("42\n"), nil, func() bool { return testStruct.Count == 42 }},
+		{"hostname", []byte("example.com"), nil, func() bool { return testStruct.Name == "example.com" }},
+		{"Version", []byte("2.0"), fuse.EPERM, func() bool { return testStruct.Version == "1.0" }},
+		{"nested/Level", []byte("3"), nil, func() bool { return testStruct.Nested.Level == 3 }},
+		{"Pointer/Level", []byte("4"), nil, func() bool { return testStruct.Pointer.Level == 4 }},
+		{"Started", []byte("1600000000"), nil, func() bool { return testStruct.Started.Equal(time.Unix(1600000000, 0)) }},
+	}
+
+	for _, test := range writeTests {
+		t.Run("write "+test.name, func(t *testing.T) {
+			file, err := os.OpenFile(path.Join(dpath, test.name), os.O_WRONLY, 0666)
+			if err != nil {
+				t.Fatalf("failed to open node: %v", err)
+			}
+			defer file.Close()
+
+			_, err = file.Write(test.writeVal)
+			if !checkError(err, test.writeErr) {
+				t.Errorf("incorrect error writing '%s', expected: %v, got: %v", test.writeVal, test.writeErr, err)
+			}
+
+			if !test.check() {
+				t.Errorf("field not correct after writing '%s'", test.writeVal)
+			}
+		})
+	}
+
+	t.Run("read", func(t *testing.T) {
+		r, err := ioutil.ReadFile(path.Join(dpath, "Version"))
+		if err != nil {
+			t.Fatalf("couldn't read file: %v", err)
+		}
+
+		if !bytes.Equal(r, []byte("1.0")) {
+			t.Errorf("incorrect value read: expected '1.0', got '%s'", r)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := NewStructDir(testStruct); err == nil {
+			t.Errorf("expected error creating dir from non-pointer")
+		}
+
+		var unsupported struct{ C complex128 }
+		if _, err := NewStructDir(&unsupported); err == nil {
+			t.Errorf("expected error creating dir with unsupported field")
+		}
+
+		var duplicate struct {
+			A int `fusebox:"name"`
+			B int `fusebox:"name"`
+		}
+		if _, err := NewStructDir(&duplicate); err == nil {
+			t.Errorf("expected error creating dir with duplicate names")
+		}
+
+		var writeOnly struct {
+			C chan int `fusebox:",ro"`
+		}
+		writeOnly.C = make(chan int)
+		if _, err := NewStructDir(&writeOnly); err == nil {
+			t.Errorf("expected error creating dir with read-only chan int")
+		}
+	})
+}
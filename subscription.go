@@ -0,0 +1,196 @@
+package fusebox
+
+import (
+	"context"
+	"path"
+	"sync"
+)
+
+// A ChangeEvent describes a change made to the value of a File.
+type ChangeEvent struct {
+	// The path of the File relative to the node that was subscribed to. This
+	// is empty when subscribing to a File directly.
+	Path string
+
+	// The value of the File before and after the change, as returned by its
+	// Element's ValRead function. For files with Stream set, Old is nil and
+	// New is the data that was written.
+	Old []byte
+	New []byte
+
+	// The uid and pid of the process that made the change.
+	Uid uint32
+	Pid uint32
+}
+
+// DropPolicy controls what happens when a ChangeEvent is sent to a
+// Subscription whose buffer is full.
+type DropPolicy int
+
+const (
+	// DropNewest discards the event being sent.
+	DropNewest DropPolicy = iota
+
+	// DropOldest discards the oldest event in the buffer to make room for
+	// the one being sent.
+	DropOldest
+
+	// Block waits until there is room in the buffer. Note that this blocks
+	// the write that caused the change.
+	Block
+)
+
+// A Subscription receives ChangeEvents from the Files and Dirs it is
+// subscribed to.
+type Subscription struct {
+	// The channel the events are delivered on.
+	C <-chan ChangeEvent
+
+	c      chan ChangeEvent
+	policy DropPolicy
+	mu     sync.Mutex
+}
+
+// NewSubscription returns a Subscription with the given buffer size, which
+// handles a full buffer according to the given DropPolicy.
+func NewSubscription(buffer int, policy DropPolicy) *Subscription {
+	c := make(chan ChangeEvent, buffer)
+	return &Subscription{C: c, c: c, policy: policy}
+}
+
+// send delivers the event according to the Subscription's DropPolicy.
+func (s *Subscription) send(ev ChangeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.policy {
+	case Block:
+		s.c <- ev
+	case DropOldest:
+		for {
+			select {
+			case s.c <- ev:
+				return
+			default:
+			}
+
+			select {
+			case <-s.c:
+			default:
+			}
+		}
+	default:
+		select {
+		case s.c <- ev:
+		default:
+		}
+	}
+}
+
+// subscribable is implemented by nodes which can be subscribed to, with
+// events reporting the given path.
+type subscribable interface {
+	subscribe(s *Subscription, path string)
+	unsubscribe(s *Subscription)
+}
+
+// Subscribe sends an event to s whenever the value of the File is changed.
+func (f *File) Subscribe(s *Subscription) {
+	f.subscribe(s, "")
+}
+
+// Unsubscribe stops events being sent to s.
+func (f *File) Unsubscribe(s *Subscription) {
+	f.unsubscribe(s)
+}
+
+func (f *File) subscribe(s *Subscription, path string) {
+	f.subsMu.Lock()
+	defer f.subsMu.Unlock()
+	if f.subs == nil {
+		f.subs = make(map[*Subscription]string)
+	}
+	f.subs[s] = path
+}
+
+func (f *File) unsubscribe(s *Subscription) {
+	f.subsMu.Lock()
+	defer f.subsMu.Unlock()
+	delete(f.subs, s)
+}
+
+// subscriptions returns a copy of the File's subscriptions.
+func (f *File) subscriptions() map[*Subscription]string {
+	f.subsMu.Lock()
+	defer f.subsMu.Unlock()
+	ret := make(map[*Subscription]string, len(f.subs))
+	for s, p := range f.subs {
+		ret[s] = p
+	}
+	return ret
+}
+
+// Subscribe sends an event to s whenever the value of a File in the Dir, or
+// any of its subdirectories, is changed. Nodes added to the Dir with AddNode
+// after subscribing are included.
+func (d *Dir) Subscribe(s *Subscription) {
+	d.subscribe(s, "")
+}
+
+// Unsubscribe stops events from the Dir and its subdirectories being sent to s.
+func (d *Dir) Unsubscribe(s *Subscription) {
+	d.unsubscribe(s)
+}
+
+func (d *Dir) subscribe(s *Subscription, prefix string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.subs == nil {
+		d.subs = make(map[*Subscription]string)
+	}
+	d.subs[s] = prefix
+
+	ctx := context.Background()
+	for _, k := range d.Element.GetKeys(ctx) {
+		n, err := d.Element.GetNode(ctx, k)
+		if err != nil {
+			continue
+		}
+
+		if sn, ok := n.(subscribable); ok {
+			sn.subscribe(s, path.Join(prefix, k))
+		}
+	}
+}
+
+func (d *Dir) unsubscribe(s *Subscription) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.subs, s)
+
+	ctx := context.Background()
+	for _, k := range d.Element.GetKeys(ctx) {
+		n, err := d.Element.GetNode(ctx, k)
+		if err != nil {
+			continue
+		}
+
+		if sn, ok := n.(subscribable); ok {
+			sn.unsubscribe(s)
+		}
+	}
+}
+
+// moveSubscriptions unsubscribes the Dir's subscriptions from old and
+// subscribes them to new, which has replaced old at the given name. Either
+// may be nil. The caller must hold d.mu.
+func (d *Dir) moveSubscriptions(name string, old, new interface{}) {
+	for s, prefix := range d.subs {
+		if sn, ok := old.(subscribable); ok {
+			sn.unsubscribe(s)
+		}
+
+		if sn, ok := new.(subscribable); ok {
+			sn.subscribe(s, path.Join(prefix, name))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package fusebox
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"bazil.org/fuse"
+)
+
+func expectEvent(t *testing.T, s *Subscription, p string, old, new []byte) {
+	select {
+	case ev := <-s.C:
+		if ev.Path != p {
+			t.Errorf("incorrect event path, expected '%v', got '%v'", p, ev.Path)
+		}
+
+		if !bytes.Equal(ev.Old, old) || !bytes.Equal(ev.New, new) {
+			t.Errorf("incorrect event values, expected '%s' -> '%s', got '%s' -> '%s'", old, new, ev.Old, ev.New)
+		}
+
+		if ev.Uid != uint32(os.Getuid()) {
+			t.Errorf("incorrect event uid, expected %v, got %v", os.Getuid(), ev.Uid)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("timed out waiting for event for '%v'", p)
+	}
+}
+
+func expectNoEvent(t *testing.T, s *Subscription) {
+	select {
+	case ev := <-s.C:
+		t.Errorf("unexpected event: %v", ev)
+	default:
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	var (
+		testInt    int
+		testString string
+		testBool   bool
+	)
+
+	d := NewEmptyDir()
+	sub := NewEmptyDir()
+	d.AddNode("int", NewIntFile(&testInt))
+	d.AddNode("sub", sub)
+	sub.AddNode("string", NewStringFile(&testString))
+
+	name := "subscriptions"
+	if err := rootdir.AddNode(name, d); err != nil {
+		t.Fatalf("failed to add dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	dpath := path.Join(mountpoint, name)
+
+	s1 := NewSubscription(10, DropNewest)
+	s2 := NewSubscription(10, DropNewest)
+	d.Subscribe(s1)
+	sub.Subscribe(s2)
+
+	t.Run("file in dir", func(t *testing.T) {
+		if err := ioutil.WriteFile(path.Join(dpath, "int"), []byte("5"), 0666); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		expectEvent(t, s1, "int", []byte("0"), []byte("5"))
+		expectNoEvent(t, s2)
+	})
+
+	t.Run("file in subdir", func(t *testing.T) {
+		if err := ioutil.WriteFile(path.Join(dpath, "sub", "string"), []byte("hello\n"), 0666); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		expectEvent(t, s1, "sub/string", []byte(""), []byte("hello"))
+		expectEvent(t, s2, "string", []byte(""), []byte("hello"))
+	})
+
+	t.Run("added node", func(t *testing.T) {
+		sub.AddNode("bool", NewBoolFile(&testBool))
+		if err := ioutil.WriteFile(path.Join(dpath, "sub", "bool"), []byte("1"), 0666); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		expectEvent(t, s1, "sub/bool", []byte("0"), []byte("1"))
+		expectEvent(t, s2, "bool", []byte("0"), []byte("1"))
+	})
+
+	t.Run("failed write", func(t *testing.T) {
+		ioutil.WriteFile(path.Join(dpath, "sub", "bool"), []byte("2"), 0666)
+		expectNoEvent(t, s1)
+		expectNoEvent(t, s2)
+	})
+
+	t.Run("removed node", func(t *testing.T) {
+		f := NewIntFile(&testInt)
+		d.AddNode("removed", f)
+		d.RemoveNode("removed")
+		f.Write(context.Background(), &fuse.WriteRequest{Data: []byte("1")}, &fuse.WriteResponse{})
+		expectNoEvent(t, s1)
+	})
+
+	t.Run("unsubscribe", func(t *testing.T) {
+		d.Unsubscribe(s1)
+		if err := ioutil.WriteFile(path.Join(dpath, "sub", "string"), []byte("world"), 0666); err != nil {
+			t.Fatalf("failed to write node: %v", err)
+		}
+
+		expectNoEvent(t, s1)
+		expectEvent(t, s2, "string", []byte("hello"), []byte("world"))
+	})
+
+	t.Run("drop policies", func(t *testing.T) {
+		f := NewIntFile(&testInt)
+		newest := NewSubscription(1, DropNewest)
+		oldest := NewSubscription(1, DropOldest)
+		f.Subscribe(newest)
+		f.Subscribe(oldest)
+		for _, v := range []string{"1", "2"} {
+			f.Write(context.Background(), &fuse.WriteRequest{Data: []byte(v)}, &fuse.WriteResponse{})
+		}
+
+		if ev := <-newest.C; !bytes.Equal(ev.New, []byte("1")) {
+			t.Errorf("DropNewest kept wrong event, expected '1', got '%s'", ev.New)
+		}
+
+		if ev := <-oldest.C; !bytes.Equal(ev.New, []byte("2")) {
+			t.Errorf("DropOldest kept wrong event, expected '2', got '%s'", ev.New)
+		}
+	})
+}
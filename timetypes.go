@@ -0,0 +1,68 @@
+package fusebox
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NewDurationFile returns a File which has an element that reads and updates
+// the given time.Duration pointer. Values are displayed and parsed in the
+// format used by time.Duration.String and time.ParseDuration, such as "1m30s".
+func NewDurationFile(d *time.Duration) *File {
+	return NewValueFile(d, time.ParseDuration, time.Duration.String)
+}
+
+// NewTimeFile returns a File which has an element that reads and updates the
+// given time.Time pointer, using the RFC3339 layout. This is equivalent to
+// NewTimeFileLayout(t, time.RFC3339).
+func NewTimeFile(t *time.Time) *File {
+	return NewTimeFileLayout(t, time.RFC3339)
+}
+
+// NewTimeFileLayout returns a File which has an element that reads and
+// updates the given time.Time pointer. Values are displayed and parsed using
+// the given layout, as with time.Time.Format and time.Parse. Integers are also
+// accepted when writing, and are treated as unix timestamps in seconds.
+func NewTimeFileLayout(t *time.Time, layout string) *File {
+	parse := func(s string) (time.Time, error) {
+		if isInteger(s) {
+			secs, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(secs, 0), nil
+		}
+		return time.Parse(layout, s)
+	}
+
+	format := func(t time.Time) string {
+		return t.Format(layout)
+	}
+
+	return NewValueFile(t, parse, format)
+}
+
+// isInteger returns whether s is a non-empty string of digits, optionally
+// preceded by a sign.
+func isInteger(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	if len(s) == 0 {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewLocationFile returns a File which has an element that reads and updates
+// the given *time.Location pointer. Locations are displayed and parsed using
+// their IANA time zone names, such as "Europe/London", as with
+// time.LoadLocation. A nil location is displayed as "UTC".
+func NewLocationFile(l **time.Location) *File {
+	return NewValueFile(l, time.LoadLocation, (*time.Location).String)
+}
@@ -0,0 +1,229 @@
+package fusebox
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fromFloat converts f to T, rounding it to the nearest integer if T is an
+// integer type. strconv.ErrRange is returned if the result doesn't fit in T.
+func fromFloat[T number](f float64) (T, error) {
+	if math.IsNaN(f) {
+		return 0, strconv.ErrRange
+	}
+
+	half := 0.5
+	if T(half) != 0 {
+		t := T(f)
+		if math.IsInf(float64(t), 0) && !math.IsInf(f, 0) {
+			return 0, strconv.ErrRange
+		}
+		return t, nil
+	}
+
+	f = math.Round(f)
+	t := T(f)
+	if float64(t) != f {
+		return 0, strconv.ErrRange
+	}
+	return t, nil
+}
+
+// splitUnit splits s into a leading number and the unit following it, which
+// may be separated from the number by whitespace.
+func splitUnit(s string) (float64, string, error) {
+	i := strings.IndexFunc(s, func(c rune) bool {
+		return (c < '0' || c > '9') && c != '.' && c != '+' && c != '-'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	f, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return f, strings.TrimSpace(s[i:]), nil
+}
+
+// ByteFormat controls how files created with NewByteSizeFile display their
+// values.
+type ByteFormat int
+
+const (
+	// BinaryBytes displays values using the largest fitting power of 1024,
+	// such as "10MiB".
+	BinaryBytes ByteFormat = iota
+
+	// DecimalBytes displays values using the largest fitting power of 1000,
+	// such as "1.5GB".
+	DecimalBytes
+
+	// PlainBytes displays values as a plain number of bytes.
+	PlainBytes
+)
+
+// byteUnit is a unit of bytes, and its size.
+type byteUnit struct {
+	name string
+	size float64
+}
+
+var binaryByteUnits = []byteUnit{
+	{"PiB", 1 << 50}, {"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+}
+
+var decimalByteUnits = []byteUnit{
+	{"PB", 1e15}, {"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3},
+}
+
+// byteUnitSizes maps the lower case names of units accepted when writing to a
+// byte size file to their sizes.
+var byteUnitSizes = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1e3, "kb": 1e3, "ki": 1 << 10, "kib": 1 << 10,
+	"m": 1e6, "mb": 1e6, "mi": 1 << 20, "mib": 1 << 20,
+	"g": 1e9, "gb": 1e9, "gi": 1 << 30, "gib": 1 << 30,
+	"t": 1e12, "tb": 1e12, "ti": 1 << 40, "tib": 1 << 40,
+	"p": 1e15, "pb": 1e15, "pi": 1 << 50, "pib": 1 << 50,
+}
+
+// NewByteSizeFile returns a File which has an element that reads and updates
+// the given integer as a number of bytes. Written values may have a decimal
+// (KB, MB, ...) or binary (KiB, MiB, ...) unit suffix, such as "10MiB" or
+// "1.5GB", and plain numbers are treated as bytes. Values are displayed
+// according to the given ByteFormat. Values which don't fit in the integer
+// are rejected with fuse.ERANGE.
+func NewByteSizeFile[T integer](i *T, format ByteFormat) *File {
+	return relativeValueFile(i, withExpressions(i, parseByteSize[T]), func(v T) string {
+		return formatByteSize(float64(v), format)
+	})
+}
+
+func parseByteSize[T integer](s string) (T, error) {
+	f, unit, err := splitUnit(s)
+	if err != nil {
+		return 0, err
+	}
+
+	size, ok := byteUnitSizes[strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit: %v", unit)
+	}
+	return fromFloat[T](f * size)
+}
+
+func formatByteSize(v float64, format ByteFormat) string {
+	var units []byteUnit
+	switch format {
+	case BinaryBytes:
+		units = binaryByteUnits
+	case DecimalBytes:
+		units = decimalByteUnits
+	}
+
+	for _, u := range units {
+		if math.Abs(v) >= u.size {
+			return strconv.FormatFloat(v/u.size, 'f', -1, 64) + u.name
+		}
+	}
+
+	if format == PlainBytes {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64) + "B"
+}
+
+// rateUnits maps durations to the units used to display rates per that
+// duration.
+var rateUnits = map[time.Duration]string{
+	time.Nanosecond:  "ns",
+	time.Microsecond: "us",
+	time.Millisecond: "ms",
+	time.Second:      "s",
+	time.Minute:      "m",
+	time.Hour:        "h",
+}
+
+// NewRateFile returns a File which has an element that reads and updates the
+// given number as a rate per the given duration. Values are displayed with the
+// duration as a unit, such as "100/s". Written values may be given per any
+// duration, such as "6000/m" or "5/10s", and are converted to be per the given
+// duration, while plain numbers are stored as is. Values which don't fit in
+// the number are rejected with fuse.ERANGE.
+func NewRateFile[T number](r *T, per time.Duration) *File {
+	unit, ok := rateUnits[per]
+	if !ok {
+		unit = per.String()
+	}
+
+	parse := func(s string) (T, error) {
+		i := strings.IndexByte(s, '/')
+		if i < 0 {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return 0, err
+			}
+			return fromFloat[T](f)
+		}
+
+		f, err := strconv.ParseFloat(strings.TrimSpace(s[:i]), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		d := strings.TrimSpace(s[i+1:])
+		if len(d) > 0 && (d[0] < '0' || d[0] > '9') {
+			d = "1" + d
+		}
+
+		dur, err := time.ParseDuration(d)
+		if err != nil {
+			return 0, err
+		}
+		if dur <= 0 {
+			return 0, strconv.ErrRange
+		}
+		return fromFloat[T](f * float64(per) / float64(dur))
+	}
+
+	format := func(v T) string {
+		return strconv.FormatFloat(float64(v), 'f', -1, 64) + "/" + unit
+	}
+
+	return relativeValueFile(r, withExpressions(r, parse), format)
+}
+
+// NewPercentFile returns a File which has an element that reads and updates
+// the given number as a percentage, where full is the value representing 100%.
+// For example, a full of 1 stores 75% as 0.75, while a full of 100 stores it as
+// 75. Values are displayed as a percentage with prec decimal places, or the
+// fewest needed to represent the value exactly if prec is -1. Written values
+// ending in % are converted, while plain numbers are stored as is. Values
+// which don't fit in the number are rejected with fuse.ERANGE.
+func NewPercentFile[T number](p *T, full T, prec int) *File {
+	parse := func(s string) (T, error) {
+		if !strings.HasSuffix(s, "%") {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return 0, err
+			}
+			return fromFloat[T](f)
+		}
+
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+		if err != nil {
+			return 0, err
+		}
+		return fromFloat[T](f / 100 * float64(full))
+	}
+
+	format := func(v T) string {
+		return strconv.FormatFloat(float64(v)/float64(full)*100, 'f', prec, 64) + "%"
+	}
+
+	return relativeValueFile(p, withExpressions(p, parse), format)
+}
@@ -0,0 +1,283 @@
+package fusebox
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"bazil.org/fuse"
+)
+
+// NewURLDir returns a Dir exposing the parts of the given url.URL as
+// individual files, which can each be read and written to update the URL:
+//
+//	scheme    the scheme, such as "https"
+//	host      the host name or IP address, without the port
+//	port      the port, which is empty if not set
+//	path      the unescaped path
+//	fragment  the unescaped fragment
+//	user      the user info, in the form "user" or "user:password"
+//	url       the whole URL, as with NewURLFile
+//	query/    a directory containing a file for each query parameter
+//
+// The query directory has a file for each parameter, containing its values one
+// per line. Creating a file in the directory adds a parameter, and removing one
+// deletes it. Writes which would result in an invalid URL are rejected with
+// fuse.ERANGE, leaving the URL unchanged.
+//
+// The nodes share a single lock, and are opened with direct IO so that reads
+// reflect changes made through the other nodes.
+func NewURLDir(u *url.URL) *Dir {
+	lock := &sync.RWMutex{}
+	file := func(f *File) *File {
+		f.Lock = lock
+		f.OpenFlags = fuse.OpenDirectIO
+		return f
+	}
+
+	e := &urlQueryElement{Data: u, newFile: file}
+	query := NewDir(e)
+	query.Mode = os.ModeDir | 0666
+	query.mu = lock
+	e.dir = query
+
+	return NewMapDir(map[string]VarNodeable{
+		"scheme":   file(newURLPartFile(u, getURLScheme, setURLScheme)),
+		"host":     file(newURLPartFile(u, (*url.URL).Hostname, setURLHost)),
+		"port":     file(newURLPartFile(u, (*url.URL).Port, setURLPort)),
+		"path":     file(newURLPartFile(u, getURLPath, setURLPath)),
+		"fragment": file(newURLPartFile(u, getURLFragment, setURLFragment)),
+		"user":     file(newURLPartFile(u, getURLUser, setURLUser)),
+		"url":      file(NewURLFile(u)),
+		"query":    query,
+	})
+}
+
+// newURLPartFile returns a File which reads part of the given url.URL using
+// get, and updates it using set. Values are set on a copy of the URL, which
+// must still be valid after the change for it to be assigned.
+func newURLPartFile(u *url.URL, get func(*url.URL) string, set func(*url.URL, string) error) *File {
+	parse := func(s string) (url.URL, error) {
+		ret := *u
+		if err := set(&ret, s); err != nil {
+			return url.URL{}, err
+		}
+
+		if _, err := url.Parse(ret.String()); err != nil {
+			return url.URL{}, err
+		}
+		return ret, nil
+	}
+
+	format := func(u url.URL) string {
+		return get(&u)
+	}
+
+	return NewValueFile(u, parse, format)
+}
+
+func getURLScheme(u *url.URL) string {
+	return u.Scheme
+}
+
+func setURLScheme(u *url.URL, s string) error {
+	u.Scheme = s
+	return nil
+}
+
+// joinHost combines a host name and port into the form used by url.URL.Host.
+func joinHost(host, port string) string {
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func setURLHost(u *url.URL, s string) error {
+	u.Host = joinHost(s, u.Port())
+	return nil
+}
+
+func setURLPort(u *url.URL, s string) error {
+	if s != "" {
+		if _, err := strconv.ParseUint(s, 10, 16); err != nil {
+			return err
+		}
+	}
+
+	u.Host = joinHost(u.Hostname(), s)
+	return nil
+}
+
+func getURLPath(u *url.URL) string {
+	return u.Path
+}
+
+func setURLPath(u *url.URL, s string) error {
+	u.Path = s
+	u.RawPath = ""
+	return nil
+}
+
+func getURLFragment(u *url.URL) string {
+	return u.Fragment
+}
+
+func setURLFragment(u *url.URL, s string) error {
+	u.Fragment = s
+	u.RawFragment = ""
+	return nil
+}
+
+func getURLUser(u *url.URL) string {
+	if u.User == nil {
+		return ""
+	}
+
+	if p, ok := u.User.Password(); ok {
+		return u.User.Username() + ":" + p
+	}
+	return u.User.Username()
+}
+
+func setURLUser(u *url.URL, s string) error {
+	if s == "" {
+		u.User = nil
+		return nil
+	}
+
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		u.User = url.UserPassword(s[:i], s[i+1:])
+		return nil
+	}
+	u.User = url.User(s)
+	return nil
+}
+
+// urlQueryElement is used to represent the query parameters of a url.URL as
+// the files in a Dir.
+type urlQueryElement struct {
+	Data    *url.URL
+	newFile func(*File) *File
+
+	// The Dir the element belongs to, whose subscriptions are given to the
+	// files created for parameters which appear after it was subscribed to.
+	dir *Dir
+
+	// The files for each parameter, which are created on lookup while the
+	// dir is only read locked.
+	mu    sync.Mutex
+	files map[string]*File
+}
+
+// file returns the File for the query parameter with the given name, creating
+// it if needed. A new File is subscribed to the Dir's subscriptions, as the
+// parameter may have been added by changing the URL through another node. The
+// caller must hold the Dir's lock.
+func (e *urlQueryElement) file(k string) *File {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if f, ok := e.files[k]; ok {
+		return f
+	}
+
+	parse := func(s string) (url.URL, error) {
+		ret := *e.Data
+		q := ret.Query()
+		q[k] = strings.Split(s, "\n")
+		ret.RawQuery = q.Encode()
+		return ret, nil
+	}
+
+	format := func(u url.URL) string {
+		return strings.Join(u.Query()[k], "\n")
+	}
+
+	if e.files == nil {
+		e.files = make(map[string]*File)
+	}
+	f := e.newFile(NewValueFile(e.Data, parse, format))
+	if e.dir != nil {
+		for s, prefix := range e.dir.subs {
+			f.subscribe(s, path.Join(prefix, k))
+		}
+	}
+
+	e.files[k] = f
+	return f
+}
+
+func (e *urlQueryElement) GetNode(ctx context.Context, k string) (VarNode, error) {
+	if _, ok := e.Data.Query()[k]; !ok {
+		return nil, fuse.ENOENT
+	}
+	return e.file(k), nil
+}
+
+func (e *urlQueryElement) GetDirentType(ctx context.Context, k string) (fuse.DirentType, error) {
+	if _, ok := e.Data.Query()[k]; !ok {
+		return fuse.DT_Unknown, fuse.ENOENT
+	}
+	return fuse.DT_File, nil
+}
+
+// GetKeys returns the names of the query parameters. The files of parameters
+// which have since been removed by changing the URL are dropped, so that they
+// aren't left with subscriptions when the Dir is unsubscribed from.
+func (e *urlQueryElement) GetKeys(context.Context) []string {
+	q := e.Data.Query()
+	ret := make([]string, 0, len(q))
+	for k := range q {
+		ret = append(ret, k)
+	}
+
+	e.mu.Lock()
+	for k := range e.files {
+		if _, ok := q[k]; !ok {
+			delete(e.files, k)
+		}
+	}
+	e.mu.Unlock()
+
+	sort.Strings(ret)
+	return ret
+}
+
+func (e *urlQueryElement) AddNode(name string, node interface{}) error {
+	return fmt.Errorf("cannot add node (%v) to URL query, create a file instead", name)
+}
+
+func (e *urlQueryElement) RemoveNode(name string) error {
+	q := e.Data.Query()
+	if _, ok := q[name]; !ok {
+		return fuse.ENOENT
+	}
+
+	q.Del(name)
+	e.Data.RawQuery = q.Encode()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.files, name)
+	return nil
+}
+
+// CreateNode adds a query parameter with the given name and an empty value.
+func (e *urlQueryElement) CreateNode(ctx context.Context, name string) (VarNode, error) {
+	q := e.Data.Query()
+	if _, ok := q[name]; !ok {
+		q.Set(name, "")
+		e.Data.RawQuery = q.Encode()
+	}
+	return e.file(name), nil
+}
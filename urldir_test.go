@@ -0,0 +1,111 @@
+package fusebox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+
+	"bazil.org/fuse"
+)
+
+func TestURLDir(t *testing.T) {
+	u, err := url.Parse("http://example.com:8080/a?x=1#top")
+	if err != nil {
+		t.Fatalf("failed to parse url: %v", err)
+	}
+
+	name := "urldir"
+	dir := NewURLDir(u)
+	if err := rootdir.AddNode(name, dir); err != nil {
+		t.Fatalf("failed to add dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	dpath := path.Join(mountpoint, name)
+
+	t.Run("nodes", func(t *testing.T) {
+		checkDirContents(t, dpath, []string{"scheme", "host", "port", "path", "fragment", "user", "url", "query"})
+		checkDirContents(t, path.Join(dpath, "query"), []string{"x"})
+	})
+
+	tests := []struct {
+		name     string
+		writeVal []byte
+		writeErr error
+		readVal  []byte
+		url      string
+	}{
+		{"scheme", []byte("https\n"), nil, []byte("https"), "https://example.com:8080/a?x=1#top"},
+		{"host", []byte("::1"), nil, []byte("::1"), "https://[::1]:8080/a?x=1#top"},
+		{"port", []byte("443"), nil, []byte("443"), "https://[::1]:443/a?x=1#top"},
+		{"port", []byte("http"), fuse.ERANGE, []byte("443"), "https://[::1]:443/a?x=1#top"},
+		{"port", []byte(""), nil, []byte(""), "https://[::1]/a?x=1#top"},
+		{"path", []byte("/b c"), nil, []byte("/b c"), "https://[::1]/b%20c?x=1#top"},
+		{"fragment", []byte("end"), nil, []byte("end"), "https://[::1]/b%20c?x=1#end"},
+		{"user", []byte("bob:secret"), nil, []byte("bob:secret"), "https://bob:secret@[::1]/b%20c?x=1#end"},
+		{"query/x", []byte("2\n3"), nil, []byte("2\n3"), "https://bob:secret@[::1]/b%20c?x=2&x=3#end"},
+		{"query/y", []byte("new"), nil, []byte("new"), "https://bob:secret@[::1]/b%20c?x=2&x=3&y=new#end"},
+		{"url", []byte("http://localhost/?z=9"), nil, []byte("http://localhost/?z=9"), "http://localhost/?z=9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := path.Join(dpath, tt.name)
+			err := ioutil.WriteFile(p, tt.writeVal, 0666)
+			if !checkError(err, tt.writeErr) {
+				t.Errorf("incorrect error writing '%s', expected: %v, got: %v", tt.writeVal, tt.writeErr, err)
+			}
+
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				t.Fatalf("failed to read node: %v", err)
+			}
+
+			if !bytes.Equal(data, tt.readVal) {
+				t.Errorf("incorrect value read, expected '%s', got '%s'", tt.readVal, data)
+			}
+
+			if u.String() != tt.url {
+				t.Errorf("incorrect url, expected '%v', got '%v'", tt.url, u)
+			}
+
+			data, err = ioutil.ReadFile(path.Join(dpath, "url"))
+			if err != nil {
+				t.Fatalf("failed to read url: %v", err)
+			}
+
+			if string(data) != tt.url {
+				t.Errorf("incorrect url read, expected '%v', got '%s'", tt.url, data)
+			}
+		})
+	}
+
+	t.Run("remove parameter", func(t *testing.T) {
+		if err := os.Remove(path.Join(dpath, "query", "z")); err != nil {
+			t.Fatalf("failed to remove parameter: %v", err)
+		}
+
+		if u.RawQuery != "" {
+			t.Errorf("parameter not removed from url, got query '%v'", u.RawQuery)
+		}
+		checkDirContents(t, path.Join(dpath, "query"), []string{})
+	})
+
+	t.Run("subscribe new parameter", func(t *testing.T) {
+		s := NewSubscription(10, DropNewest)
+		dir.Subscribe(s)
+		defer dir.Unsubscribe(s)
+
+		if err := ioutil.WriteFile(path.Join(dpath, "url"), []byte("http://localhost/?a=1"), 0666); err != nil {
+			t.Fatalf("failed to write url: %v", err)
+		}
+		expectEvent(t, s, "url", []byte("http://localhost/"), []byte("http://localhost/?a=1"))
+
+		if err := ioutil.WriteFile(path.Join(dpath, "query", "a"), []byte("2"), 0666); err != nil {
+			t.Fatalf("failed to write parameter: %v", err)
+		}
+		expectEvent(t, s, "query/a", []byte("1"), []byte("2"))
+	})
+}
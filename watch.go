@@ -0,0 +1,144 @@
+package fusebox
+
+import (
+	"context"
+	"sync"
+
+	"bazil.org/fuse"
+	"bazil.org/fuse/fs"
+)
+
+// WatchFile is a read-only node which exposes the value of a File, but whose
+// reads block until that value next changes, either through a successful
+// write to the File or a call to its Touch function. It is intended to be
+// added to a Dir alongside the File it watches, for example as "name.watch".
+//
+// The first read on an open handle blocks until the next change, and then
+// returns the new value. Once the value has been read, the following read
+// returns EOF, after which the next read returns the value again if it has
+// changed since, and otherwise blocks until it does. This means
+// `cat name.watch` waits for a single change, while a program reading
+// repeatedly from the same handle doesn't miss changes made between its
+// reads, though several such changes are read as the latest value.
+type WatchFile struct {
+	// The File being watched. This should not be a File with Stream set.
+	File *File
+
+	mu      sync.Mutex
+	handles map[fuse.HandleID]*watchHandle
+}
+
+// watchHandle holds the value being read by an open handle, the offset of the
+// read it was captured for, and the number of changes to the File made before
+// it was captured.
+type watchHandle struct {
+	mu   sync.Mutex
+	data []byte
+	base int64
+	seen uint64
+}
+
+var _ VarNodeable = (*WatchFile)(nil)
+
+// NewWatchFile returns a WatchFile which watches the given File.
+func NewWatchFile(f *File) *WatchFile {
+	return &WatchFile{File: f}
+}
+
+// Attr sets the mode to read-only, and the size to zero as the value isn't
+// known until it is read.
+func (w *WatchFile) Attr(ctx context.Context, attr *fuse.Attr) error {
+	attr.Mode = 0444
+	attr.Size = 0
+	return nil
+}
+
+// DirentType will return fuse.DT_File for WatchFile.
+func (*WatchFile) DirentType() fuse.DirentType {
+	return fuse.DT_File
+}
+
+// Node returns the WatchFile itself. It is implemented to implement the
+// VarNodeable interface.
+func (w *WatchFile) Node() VarNode {
+	return w
+}
+
+// Open returns the WatchFile as the handle, using direct IO so that every read
+// reaches Read.
+func (w *WatchFile) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	resp.Flags |= fuse.OpenDirectIO
+	return w, nil
+}
+
+// Read waits for the watched File to change if the handle has no value
+// pending and has read the latest value, and then returns the data from the
+// value starting at the requested offset. If the wait is cancelled, fuse.EINTR
+// is returned.
+func (w *WatchFile) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	if w.File.Mode&0444 == 0 {
+		return fuse.EPERM
+	}
+
+	w.mu.Lock()
+	if w.handles == nil {
+		w.handles = make(map[fuse.HandleID]*watchHandle)
+	}
+	h, ok := w.handles[req.Handle]
+	if !ok {
+		// The first read waits for the next change.
+		_, gen := w.File.changeSignal()
+		h = &watchHandle{seen: gen}
+		w.handles[req.Handle] = h
+	}
+	w.mu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.data == nil {
+		changed, gen := w.File.changeSignal()
+		if gen == h.seen {
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return fuse.EINTR
+			}
+			_, gen = w.File.changeSignal()
+		}
+
+		w.File.Lock.RLock()
+		data, err := w.File.Element.ValRead(ctx)
+		w.File.Lock.RUnlock()
+		if err != nil {
+			return err
+		}
+
+		h.data = data
+		h.base = req.Offset
+		h.seen = gen
+	}
+
+	off := req.Offset - h.base
+	if off < 0 {
+		off = 0
+	}
+
+	resp.Data = readAt(h.data, off, req.Size)
+	if len(resp.Data) == 0 {
+		h.data = nil
+	}
+	return nil
+}
+
+// Write returns fuse.EPERM, as WatchFile is read-only.
+func (*WatchFile) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	return fuse.EPERM
+}
+
+// Release discards any value pending for the handle.
+func (w *WatchFile) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.handles, req.Handle)
+	return nil
+}
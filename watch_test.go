@@ -0,0 +1,108 @@
+package fusebox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	var testInt int
+	f := NewIntFile(&testInt)
+	d := NewEmptyDir()
+	d.AddNode("int", f)
+	d.AddNode("int.watch", NewWatchFile(f))
+
+	name := "watch"
+	if err := rootdir.AddNode(name, d); err != nil {
+		t.Fatalf("failed to add dir: %v", err)
+	}
+	defer rootdir.RemoveNode(name)
+	dpath := path.Join(mountpoint, name)
+
+	file, err := os.Open(path.Join(dpath, "int.watch"))
+	if err != nil {
+		t.Fatalf("failed to open node: %v", err)
+	}
+	defer file.Close()
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	// readChange reads a single value from the watch file in the background.
+	readChange := func() <-chan result {
+		c := make(chan result, 1)
+		go func() {
+			data, err := ioutil.ReadAll(file)
+			c <- result{data, err}
+		}()
+		return c
+	}
+
+	changes := []struct {
+		name   string
+		value  []byte
+		change func() error
+	}{
+		{"write", []byte("5"), func() error {
+			return ioutil.WriteFile(path.Join(dpath, "int"), []byte("5"), 0666)
+		}},
+		{"touch", []byte("10"), func() error {
+			testInt = 10
+			f.Touch()
+			return nil
+		}},
+	}
+
+	for _, test := range changes {
+		t.Run(test.name, func(t *testing.T) {
+			c := readChange()
+			select {
+			case r := <-c:
+				t.Fatalf("read returned before change: '%s', %v", r.data, r.err)
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if err := test.change(); err != nil {
+				t.Fatalf("failed to change value: %v", err)
+			}
+
+			select {
+			case r := <-c:
+				if r.err != nil {
+					t.Errorf("failed to read watch file: %v", r.err)
+				}
+
+				if !bytes.Equal(r.data, test.value) {
+					t.Errorf("incorrect value read, expected '%s', got '%s'", test.value, r.data)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for read")
+			}
+		})
+	}
+
+	t.Run("change between reads", func(t *testing.T) {
+		testInt = 15
+		f.Touch()
+
+		c := readChange()
+		select {
+		case r := <-c:
+			if r.err != nil {
+				t.Errorf("failed to read watch file: %v", r.err)
+			}
+
+			if !bytes.Equal(r.data, []byte("15")) {
+				t.Errorf("incorrect value read, expected '15', got '%s'", r.data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("change made between reads was missed")
+		}
+	})
+}